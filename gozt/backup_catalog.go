@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/gkdada/gozt/ztbackup"
+	"golang.org/x/text/message"
+)
+
+// gozt find pattern
+func cmdFind(bkp *ztbackup.Backup, params []string) {
+	if len(params) != 1 {
+		Fatalln("Expecting a single file name or pattern to find")
+	}
+
+	cats := ztbackup.CatalogFiles()
+	if len(cats) == 0 {
+		Fatalln("No catalog found. The catalog is updated by every backup run.")
+	}
+
+	pr := message.NewPrinter(message.MatchLanguage("en"))
+	nFound := 0
+	for _, fPath := range cats {
+		hdr, entries, err := ztbackup.LoadCatalogFile(fPath)
+		if err != nil {
+			fmt.Printf("Error reading catalog %s : %v\r\n", fPath, err)
+			continue
+		}
+		for _, ce := range entries {
+			if !ztbackup.CatalogMatch(params[0], ce) {
+				continue
+			}
+			if nFound == 0 {
+				pr.Printf("\r\n        size (bytes)  modified time        version           destination\r\n")
+			}
+			pr.Printf("%20d  %s  %-16s  %s%c%s\r\n", ce.Size, ce.ModTime.Local().Format("2006-01-02 15:04:05"), ce.Version, hdr.Label, os.PathSeparator, ce.Path)
+			nFound++
+		}
+	}
+	fmt.Printf("\r\n%d file(s) found.\r\n", nFound)
+}
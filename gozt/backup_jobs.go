@@ -0,0 +1,470 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/gkdada/gozt/ztbackup"
+	"golang.org/x/text/message"
+)
+
+// Jobs are defined in a TOML file (~/.ztbackup/jobs.toml unless --config is given). Settings at the top
+// of the file are defaults for every job. e.g.
+//
+//	files = "leave"
+//	folders = "leave"
+//	recursive = true
+//	ssh_key = "~/.ssh/backup_ed25519"
+//
+//	[[job]]
+//	name = "pictures"
+//	source = "/home/myuser/Pictures"
+//	destination = "sftp://myuser@10.2.3.4/MyBackups/Pictures"
+//	exclude = ["*.tmp", "Thumbnails"]
+//	bwlimit = "2M"
+//	post = "notify-send 'pictures backed up'"
+const jobFileName = "jobs.toml"
+
+// settings that may be given per job or as defaults for all jobs
+type jobSettings struct {
+	Files      string   `toml:"files"`   //ask, leave or delete (-a, -l, -d)
+	Folders    string   `toml:"folders"` //ask, leave or delete (-b, -m, -e)
+	Recursive  *bool    `toml:"recursive"`
+	Versions   *bool    `toml:"versions"`
+	Exclude    []string `toml:"exclude"`
+	SshKey     string   `toml:"ssh_key"`
+	BwLimit    string   `toml:"bwlimit"`     //bytes per second. K, M and G suffixes allowed.
+	Quota      string   `toml:"quota"`       //bytes (K, M, G, T) or percent of the file system the destination may use
+	SpaceCheck string   `toml:"space_check"` //warn, abort or off
+	Pre        string   `toml:"pre"`         //shell command run before the job. The job is skipped if it fails.
+	Post       string   `toml:"post"`        //shell command run after the job.
+	Schedule   string   `toml:"schedule"`    //cron-like. See cron.go
+	Jitter     string   `toml:"jitter"`      //random delay (up to this duration) added to scheduled runs. e.g. "10m"
+	LogDir     string   `toml:"log_dir"`
+	LogRotate  string   `toml:"log_rotate"`  //daily, weekly or monthly
+	LogKeep    *int     `toml:"log_keep"`    //number of log files kept
+	LogPerJob  *bool    `toml:"log_per_job"` //a separate log (named after the job) for each job
+}
+
+type ztJob struct {
+	Name        string `toml:"name"`
+	Source      string `toml:"source"`
+	Destination string `toml:"destination"`
+	jobSettings
+}
+
+type ztJobFile struct {
+	jobSettings
+	Drives []string `toml:"drives"` //the volumes (by file system UUID) whose job files gozt watch runs. See watch_linux.go
+	Jobs   []ztJob  `toml:"job"`
+}
+
+type jobResult struct {
+	Name       string
+	Statistics ztbackup.Statistics
+	Err        error
+	Duration   time.Duration
+	Results    []ztbackup.Result //for the summary file
+}
+
+// ok, partial (some files failed), failed or cancelled
+func (res *jobResult) status() string {
+	switch {
+	case errors.Is(res.Err, ztbackup.ErrCancelled):
+		return "cancelled"
+	case errors.Is(res.Err, ztbackup.ErrLocked):
+		return "locked"
+	case res.Err != nil:
+		return "failed"
+	case res.Statistics.NumErrors != 0:
+		return "partial"
+	}
+	return "ok"
+}
+
+// the job file given with --config, or the default one
+func getJobFilePath(opts map[string]string) (string, error) {
+	if cfgPath, ok := opts["config"]; ok {
+		return cfgPath, nil
+	}
+	dir, err := ztbackup.ZtFolder()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s%c%s", dir, os.PathSeparator, jobFileName), nil
+}
+
+// local paths that are relative are taken relative to baseDir (if given). e.g. the root of the drive holding the job file.
+func resolveJobPath(szPath string, baseDir string) string {
+	szPath = ztbackup.ExpandHome(szPath)
+	if len(baseDir) == 0 || strings.Contains(szPath, "://") || filepath.IsAbs(szPath) {
+		return szPath
+	}
+	return filepath.Join(baseDir, szPath)
+}
+
+func loadJobFile(fPath string, baseDir string) (*ztJobFile, error) {
+	var jf ztJobFile
+	_, err := toml.DecodeFile(fPath, &jf)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool)
+	for i := range jf.Jobs {
+		job := &jf.Jobs[i]
+		if len(job.Name) == 0 {
+			job.Name = fmt.Sprintf("job%d", i+1)
+		}
+		if !validJobName(job.Name) {
+			return nil, fmt.Errorf("invalid job name '%s'. Use letters, digits, '_', '-' and '.' only", job.Name)
+		}
+		if names[job.Name] {
+			return nil, fmt.Errorf("more than one job named '%s'", job.Name)
+		}
+		names[job.Name] = true
+		if len(job.Source) == 0 || len(job.Destination) == 0 {
+			return nil, fmt.Errorf("job '%s' needs both source and destination", job.Name)
+		}
+		job.Source = resolveJobPath(job.Source, baseDir)
+		job.Destination = resolveJobPath(job.Destination, baseDir)
+		job.inherit(jf.jobSettings)
+	}
+	return &jf, nil
+}
+
+// job names are used in systemd unit names and crontab tags (see schedule.go). So, they are kept to [A-Za-z0-9_.-]
+func validJobName(name string) bool {
+	if name == "." || name == ".." {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z') && !(c >= 'A' && c <= 'Z') && !(c >= '0' && c <= '9') && !strings.ContainsRune("_.-", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// fills in the settings not specified in the job from the defaults.
+func (js *jobSettings) inherit(def jobSettings) {
+	if len(js.Files) == 0 {
+		js.Files = def.Files
+	}
+	if len(js.Folders) == 0 {
+		js.Folders = def.Folders
+	}
+	if js.Recursive == nil {
+		js.Recursive = def.Recursive
+	}
+	if js.Versions == nil {
+		js.Versions = def.Versions
+	}
+	js.Exclude = append(append([]string{}, def.Exclude...), js.Exclude...)
+	if len(js.SshKey) == 0 {
+		js.SshKey = def.SshKey
+	}
+	if len(js.BwLimit) == 0 {
+		js.BwLimit = def.BwLimit
+	}
+	if len(js.Quota) == 0 {
+		js.Quota = def.Quota
+	}
+	if len(js.SpaceCheck) == 0 {
+		js.SpaceCheck = def.SpaceCheck
+	}
+	if len(js.Pre) == 0 {
+		js.Pre = def.Pre
+	}
+	if len(js.Post) == 0 {
+		js.Post = def.Post
+	}
+	if len(js.Schedule) == 0 {
+		js.Schedule = def.Schedule
+	}
+	if len(js.Jitter) == 0 {
+		js.Jitter = def.Jitter
+	}
+	if len(js.LogDir) == 0 {
+		js.LogDir = def.LogDir
+	}
+	if len(js.LogRotate) == 0 {
+		js.LogRotate = def.LogRotate
+	}
+	if js.LogKeep == nil {
+		js.LogKeep = def.LogKeep
+	}
+	if js.LogPerJob == nil {
+		js.LogPerJob = def.LogPerJob
+	}
+}
+
+// jobs usually run unattended. So, we leave the backups of missing files alone unless asked otherwise.
+func parseJobOption(szOpt string) (ztbackup.BackupOption, error) {
+	switch strings.ToLower(szOpt) {
+	case "", "leave":
+		return ztbackup.OptLeave, nil
+	case "ask":
+		return ztbackup.OptAsk, nil
+	case "delete":
+		return ztbackup.OptDelete, nil
+	}
+	return ztbackup.OptLeave, fmt.Errorf("unknown option '%s'. Expecting ask, leave or delete", szOpt)
+}
+
+func runHook(command string, env []string) error {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// the settings of the job, on top of the ones bkp has from the command line
+func (job *ztJob) configure(bkp *ztbackup.Backup) error {
+	var err error
+	if bkp.FileOption, err = parseJobOption(job.Files); err != nil {
+		return err
+	}
+	if bkp.FolderOption, err = parseJobOption(job.Folders); err != nil {
+		return err
+	}
+	if job.Recursive != nil {
+		bkp.RecursiveFlag = *job.Recursive
+	}
+	if job.Versions != nil {
+		bkp.VersionFlag = *job.Versions
+	}
+	bkp.Excludes = job.Exclude
+	szKeep := ""
+	if job.LogKeep != nil {
+		szKeep = strconv.Itoa(*job.LogKeep)
+	}
+	if err = bkp.Log.Configure(job.LogDir, job.LogRotate, szKeep); err != nil {
+		return err
+	}
+	if job.LogPerJob != nil && *job.LogPerJob {
+		bkp.Log.Prefix = job.Name
+	}
+	if len(job.BwLimit) != 0 {
+		if bkp.BandwidthLimit, err = ztbackup.ParseByteSize(job.BwLimit); err != nil {
+			return err
+		}
+	}
+	if len(job.Quota) != 0 {
+		bkp.Quotas = nil
+		if bkp.Quota, bkp.QuotaPercent, err = ztbackup.ParseQuota(job.Quota); err != nil {
+			return err
+		}
+	}
+	if len(job.SpaceCheck) != 0 {
+		bkp.SpaceCheck, err = ztbackup.ParseSpaceCheck(job.SpaceCheck)
+	}
+	return err
+}
+
+// The logs of the jobs of a run, by their settings. A job writes to the log of the run unless it has log
+// settings of its own (log_dir, log_per_job etc.), and the jobs with the same settings share a log. So, each
+// log is opened once for the whole run.
+type jobLogs map[jobLogKey]*ztbackup.ZtLog
+
+type jobLogKey struct {
+	dir, prefix, rotate string
+	keep                int
+}
+
+func logKey(ztl *ztbackup.ZtLog) jobLogKey {
+	return jobLogKey{ztl.Dir, ztl.Prefix, ztl.Rotate, ztl.Keep}
+}
+
+// the log to write to with the settings of ztl
+func (logs jobLogs) get(parent *ztbackup.ZtLog, ztl *ztbackup.ZtLog) *ztbackup.ZtLog {
+	key := logKey(ztl)
+	if key == logKey(parent) {
+		return parent
+	}
+	shared, ok := logs[key]
+	if !ok {
+		shared = &ztbackup.ZtLog{Dir: ztl.Dir, Prefix: ztl.Prefix, Rotate: ztl.Rotate, Keep: ztl.Keep}
+		logs[key] = shared
+	}
+	return shared
+}
+
+func (logs jobLogs) close() {
+	for _, ztl := range logs {
+		ztl.CloseLogFile()
+	}
+}
+
+// the output format, log, recursion, space check and quota settings are taken from parent (unless the job has its own)
+func (job *ztJob) Run(ctx context.Context, parent *ztbackup.Backup, logs jobLogs) (res jobResult) {
+	var bkp ztbackup.Backup
+	bkp.Console = parent.Console
+	bkp.OnEvent = parent.OnEvent
+	bkp.Display = parent.Display
+	bkp.PrescanFlag = parent.PrescanFlag
+	bkp.Prompter = parent.Prompter
+	bkp.BreakLock = parent.BreakLock
+	bkp.RescanFlag = parent.RescanFlag
+	bkp.ReflinkFlag = parent.ReflinkFlag
+	bkp.RecursiveFlag = parent.RecursiveFlag
+	bkp.SpaceCheck, bkp.Quota, bkp.QuotaPercent, bkp.Quotas = parent.SpaceCheck, parent.Quota, parent.QuotaPercent, parent.Quotas
+	bkp.Log = ztbackup.ZtLog{Dir: parent.Log.Dir, Prefix: parent.Log.Prefix, Rotate: parent.Log.Rotate, Keep: parent.Log.Keep}
+	bkp.Log.UseFileOf(&parent.Log)
+	res.Name = job.Name
+	started := time.Now()
+	ran := false
+	defer func() {
+		res.Duration = time.Since(started)
+		if ran {
+			res.Results = bkp.Results(res.Err)
+		} else {
+			//stopped before the backup (invalid configuration, pre-job command failed)
+			res.Results = []ztbackup.Result{{Source: ztbackup.FolderLabel(job.Source), Destination: ztbackup.FolderLabel(job.Destination),
+				Error: res.Err.Error()}}
+		}
+		for i := range res.Results {
+			res.Results[i].Job = job.Name
+		}
+	}()
+
+	bkp.LogPrintf("\r\nJob '%s'\r\n", job.Name)
+
+	res.Err = job.configure(&bkp)
+	if res.Err != nil {
+		bkp.LogPrintf("Invalid configuration for job '%s': %v\r\n", job.Name, res.Err)
+		return res
+	}
+	bkp.Log.UseFileOf(logs.get(&parent.Log, &bkp.Log))
+
+	env := []string{"GOZT_JOB=" + job.Name, "GOZT_SOURCE=" + job.Source, "GOZT_DESTINATION=" + job.Destination}
+	if len(job.Pre) != 0 {
+		if res.Err = runHook(job.Pre, env); res.Err != nil {
+			bkp.LogPrintf("Pre-job command failed (%v). Skipping job '%s'\r\n", res.Err, job.Name)
+			return res
+		}
+	}
+
+	ran = true
+	res.Err = bkp.Run(ctx, job.Source, []string{job.Destination}, ztbackup.FolderOptions{SshKey: job.SshKey})
+	res.Statistics = bkp.Statistics
+
+	if len(job.Post) != 0 {
+		if err := runHook(job.Post, append(env, "GOZT_STATUS="+res.status())); err != nil {
+			bkp.LogPrintf("Post-job command failed: %v\r\n", err)
+		}
+	}
+	return res
+}
+
+// runs the jobs in order. The ones left when the run is cancelled are not started.
+func runJobs(ctx context.Context, parent *ztbackup.Backup, jobs []*ztJob) []jobResult {
+	var results []jobResult
+	logs := make(jobLogs)
+	defer logs.close()
+	for _, job := range jobs {
+		if ctx.Err() != nil {
+			break
+		}
+		results = append(results, job.Run(ctx, parent, logs))
+	}
+	return results
+}
+
+// the results of every job, for the summary file
+func jobRunResults(results []jobResult) []ztbackup.Result {
+	var runs []ztbackup.Result
+	for _, res := range results {
+		runs = append(runs, res.Results...)
+	}
+	return runs
+}
+
+// prints and logs the combined summary. Returns the summary as well.
+func printJobSummary(bkp *ztbackup.Backup, results []jobResult) string {
+	pr := message.NewPrinter(message.MatchLanguage("en"))
+
+	summary := pr.Sprintf("\r\n%-20s %-8s %10s %10s %10s %10s %8s %12s\r\n", "Job", "Result", "Copied", "Restored", "Deleted", "Skipped", "Errors", "Time")
+	for _, res := range results {
+		summary += pr.Sprintf("%-20s %-8s %10d %10d %10d %10d %8d %12s\r\n", res.Name, res.status(), res.Statistics.NumFilesCopied,
+			res.Statistics.NumFilesRestored, res.Statistics.NumFilesDeleted, res.Statistics.NumFilesSkipped, res.Statistics.NumErrors, res.Duration.Round(time.Second))
+	}
+	bkp.LogPrintf("%s\r\n", summary)
+	return summary
+}
+
+// gozt run [--config file] [--jitter duration] (--all | job...)
+// returns the exit code
+func cmdRun(ctx context.Context, bkp *ztbackup.Backup, params []string, opts map[string]string) int {
+	fPath, err := getJobFilePath(opts)
+	if err != nil {
+		bkp.Printf("Unable to find the jobs : %v\r\n", err)
+		return exitFatal
+	}
+	jf, err := loadJobFile(ztbackup.ExpandHome(fPath), "")
+	if err != nil {
+		bkp.Printf("Error loading jobs from %s : %v\r\n", fPath, err)
+		return exitFatal
+	}
+
+	var jobs []*ztJob
+	if _, all := opts["all"]; all {
+		for i := range jf.Jobs {
+			jobs = append(jobs, &jf.Jobs[i])
+		}
+	} else {
+		for _, name := range params {
+			found := false
+			for i := range jf.Jobs {
+				if jf.Jobs[i].Name == name {
+					jobs = append(jobs, &jf.Jobs[i])
+					found = true
+				}
+			}
+			if !found {
+				bkp.Printf("No job named '%s' in %s\r\n", name, fPath)
+				return exitFatal
+			}
+		}
+	}
+	if len(jobs) == 0 {
+		bkp.Printf("Specify the jobs to run or --all. Jobs in %s:\r\n", fPath)
+		for _, job := range jf.Jobs {
+			bkp.Printf("  %s\r\n", job.Name)
+		}
+		return exitFatal
+	}
+
+	if szJitter, ok := opts["jitter"]; ok {
+		//a random delay first (see crontabLine)
+		jitter, err := time.ParseDuration(szJitter)
+		if err != nil || jitter < 0 {
+			bkp.Printf("Invalid jitter '%s'\r\n", szJitter)
+			return exitFatal
+		}
+		select {
+		case <-ctx.Done():
+			return exitCancelled
+		case <-time.After(jitterDelay(jitter)):
+		}
+	}
+
+	started := time.Now()
+	results := runJobs(ctx, bkp, jobs)
+	printJobSummary(bkp, results)
+	return writeSummary(bkp, opts["summary"], "run", started, jobRunResults(results))
+}
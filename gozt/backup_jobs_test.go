@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/gkdada/gozt/ztbackup"
+)
+
+func writeJobFile(t *testing.T, content string) string {
+	fPath := filepath.Join(t.TempDir(), jobFileName)
+	if err := os.WriteFile(fPath, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return fPath
+}
+
+// the settings at the top of the file are defaults for every job
+func TestLoadJobFile(t *testing.T) {
+	fPath := writeJobFile(t, `
+files = "delete"
+recursive = true
+quota = "80%"
+space_check = "abort"
+exclude = ["*.tmp"]
+log_keep = 5
+
+[[job]]
+name = "pictures"
+source = "Pictures"
+destination = "sftp://me@10.2.3.4/MyBackups/Pictures"
+files = "ask"
+exclude = ["Thumbnails"]
+log_keep = 0
+quota = "500G"
+
+[[job]]
+source = "/home/me/Documents"
+destination = "backup/Documents"
+recursive = false
+`)
+	jf, err := loadJobFile(fPath, "/media/usb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jf.Jobs) != 2 {
+		t.Fatalf("%d jobs loaded. Expected 2", len(jf.Jobs))
+	}
+
+	pics, docs := jf.Jobs[0], jf.Jobs[1]
+	if pics.Source != filepath.Join("/media/usb", "Pictures") || pics.Destination != "sftp://me@10.2.3.4/MyBackups/Pictures" {
+		t.Errorf("pictures: unexpected paths %s, %s", pics.Source, pics.Destination)
+	}
+	if pics.Files != "ask" || !*pics.Recursive || *pics.LogKeep != 0 {
+		t.Errorf("pictures: unexpected settings files %s, recursive %v, log_keep %d", pics.Files, *pics.Recursive, *pics.LogKeep)
+	}
+	if pics.Quota != "500G" || pics.SpaceCheck != "abort" {
+		t.Errorf("pictures: unexpected quota %s, space check %s", pics.Quota, pics.SpaceCheck)
+	}
+	if !reflect.DeepEqual(pics.Exclude, []string{"*.tmp", "Thumbnails"}) {
+		t.Errorf("pictures: unexpected exclusions %v", pics.Exclude)
+	}
+
+	if docs.Name != "job2" || docs.Source != "/home/me/Documents" || docs.Destination != filepath.Join("/media/usb", "backup", "Documents") {
+		t.Errorf("unexpected second job %s: %s, %s", docs.Name, docs.Source, docs.Destination)
+	}
+	if docs.Quota != "80%" || docs.SpaceCheck != "abort" {
+		t.Errorf("%s: unexpected quota %s, space check %s", docs.Name, docs.Quota, docs.SpaceCheck)
+	}
+	if docs.Files != "delete" || *docs.Recursive || *docs.LogKeep != 5 || !reflect.DeepEqual(docs.Exclude, []string{"*.tmp"}) {
+		t.Errorf("%s: unexpected settings files %s, recursive %v, log_keep %d, exclude %v", docs.Name, docs.Files, *docs.Recursive,
+			*docs.LogKeep, docs.Exclude)
+	}
+}
+
+func TestLoadJobFileInvalid(t *testing.T) {
+	for _, content := range []string{
+		"[[job]]\nsource = \"/home/me\"\n", //no destination
+		"[[job]]\nsource = \"/home/me\"\ndestination = \"/backup\"\nrecursive = \"yes\"\n",
+		"[[job]]\nname = \"my pictures\"\nsource = \"/home/me\"\ndestination = \"/backup\"\n",
+		"[[job]]\nname = \"a;rm -rf ~\"\nsource = \"/home/me\"\ndestination = \"/backup\"\n",
+		"[[job]]\nname = \"job2\"\nsource = \"/a\"\ndestination = \"/b\"\n[[job]]\nsource = \"/c\"\ndestination = \"/d\"\n", //job2 twice
+	} {
+		if _, err := loadJobFile(writeJobFile(t, content), ""); err == nil {
+			t.Errorf("loaded %q", content)
+		}
+	}
+}
+
+// the quota and space check given on the command line apply to the jobs without their own
+func TestJobConfigure(t *testing.T) {
+	cli := ztbackup.Options{SpaceCheck: "abort", Quota: 1 << 30, Quotas: map[string]ztbackup.DestQuota{"/backup": {Percent: 10}}}
+	bkp := ztbackup.Backup{Options: cli}
+	var job ztJob
+	if err := job.configure(&bkp); err != nil {
+		t.Fatal(err)
+	}
+	if bkp.SpaceCheck != "abort" || bkp.Quota != cli.Quota || len(bkp.Quotas) != 1 {
+		t.Errorf("the command line settings were not kept: %+v", bkp.Options)
+	}
+
+	job.Quota, job.SpaceCheck = "50%", "off"
+	if err := job.configure(&bkp); err != nil {
+		t.Fatal(err)
+	}
+	if bkp.SpaceCheck != "off" || bkp.Quota != 0 || bkp.QuotaPercent != 50 || bkp.Quotas != nil {
+		t.Errorf("the job settings were not used: %+v", bkp.Options)
+	}
+}
+
+// -r given to gozt run applies to the jobs that don't set recursive
+func TestJobRecursive(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	src, dst := t.TempDir(), t.TempDir()
+	os.MkdirAll(filepath.Join(src, "sub"), 0o755)
+	if err := os.WriteFile(filepath.Join(src, "sub", "f"), []byte("f"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	parent := ztbackup.Backup{Options: ztbackup.Options{RecursiveFlag: true}}
+	parent.Log.Dir = t.TempDir()
+	job := ztJob{Name: "test", Source: src, Destination: dst}
+	logs := make(jobLogs)
+	defer logs.close()
+	if res := job.Run(context.Background(), &parent, logs); res.Err != nil || res.Statistics.NumFilesCopied != 1 {
+		t.Errorf("%d files copied: %v. Expected 1", res.Statistics.NumFilesCopied, res.Err)
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/eiannone/keyboard"
+	"github.com/gkdada/gozt/ztbackup"
+	"golang.org/x/term"
+	"golang.org/x/text/message"
+)
+
+// On a terminal, a question is answered with a key press. The default is taken if there is no answer in
+// time: StdQueryDelay at first, halved with every timeout down to MinHalvingDelay (nobody is watching).
+const StdQueryDelay time.Duration = 120 * time.Second //seconds
+const MinHalvingDelay time.Duration = 4 * time.Second //minimum delay of 4 seconds. If the QueryDelay is more than this, we halve it.
+
+// --non-interactive=POLICY. The answer given when nobody can answer. If it is not one of the possible
+// answers of a question (e.g. "delete" when asking about a newer destination), the default (leave) is taken.
+var nonInteractivePolicies = map[string]rune{
+	"leave":   'l',
+	"delete":  'd',
+	"restore": 'r',
+	"backup":  'b',
+}
+
+type keyboardPrompter struct {
+	out        io.Writer
+	cancel     context.CancelCauseFunc //q cancels the run
+	QueryDelay time.Duration
+}
+
+// picks the prompter for the run: the keyboard on a terminal, the answers file, the piped stdin or the policy.
+// q at the keyboard cancels the run with cancel.
+func newPrompter(out io.Writer, cancel context.CancelCauseFunc, answersFile string, szPolicy string) (ztbackup.Prompter, error) {
+	policy, ok := nonInteractivePolicies[strings.ToLower(szPolicy)]
+	if len(szPolicy) != 0 && !ok {
+		return nil, fmt.Errorf("invalid --non-interactive policy '%s'. Expecting leave, delete, restore or backup", szPolicy)
+	}
+	fallback := ztbackup.PolicyPrompter{Policy: policy, Out: out}
+
+	if len(answersFile) != 0 {
+		f, err := os.Open(ztbackup.ExpandHome(answersFile))
+		if err != nil {
+			return nil, err
+		}
+		//stays open for the whole run
+		return ztbackup.NewLinePrompter(f, answersFile, fallback), nil
+	}
+	if term.IsTerminal(int(os.Stdin.Fd())) && len(szPolicy) == 0 {
+		return &keyboardPrompter{out: out, cancel: cancel, QueryDelay: StdQueryDelay}, nil
+	}
+	fi, err := os.Stdin.Stat()
+	if err == nil && (fi.Mode()&os.ModeNamedPipe != 0 || fi.Mode().IsRegular()) {
+		return ztbackup.NewLinePrompter(os.Stdin, "stdin", fallback), nil
+	}
+	return fallback, nil
+}
+
+// also returns whether the default was taken (timeout, no keyboard or the run was cancelled).
+// q (or Ctrl-C) cancels the run.
+func (kp *keyboardPrompter) Ask(ctx context.Context, Query string, Answers string, defaultAnswer rune) (rune, bool) {
+
+	defer keyboard.Close()
+
+	keyin, err := keyboard.GetKeys(10)
+	if err != nil {
+		fmt.Fprintf(kp.out, "Error getting key events.\r\n")
+		return defaultAnswer, true
+	}
+
+	fmt.Fprintln(kp.out, Query)
+
+	do_until := time.Now().Add(kp.QueryDelay)
+
+	for {
+		select {
+		//char, _, err := keyboard.GetSingleKey()
+		case event := <-keyin:
+			if event.Err != nil {
+				fmt.Fprintf(kp.out, "Error getting keyboard input. Taking default action.\r\n")
+				return defaultAnswer, true
+			}
+			char := event.Rune
+			char = unicode.ToLower(char)
+			if char == 'q' || event.Key == keyboard.KeyCtrlC {
+				kp.cancel(fmt.Errorf("%w by the user", ztbackup.ErrCancelled))
+				return defaultAnswer, true
+			}
+			if strings.Contains(Answers, string(char)) {
+				return char, false
+			}
+		case <-ctx.Done():
+			return defaultAnswer, true
+		default:
+			if time.Now().Before(do_until) {
+				fmt.Fprintf(kp.out, "\r[%c] in %d seconds: ", defaultAnswer, int(time.Until(do_until).Seconds())) //int(do_until.Sub(time.Now()).Seconds()))
+				time.Sleep(time.Millisecond * 20)
+			} else {
+				//timeout occurred
+				if kp.QueryDelay > MinHalvingDelay {
+					kp.QueryDelay = kp.QueryDelay / 2
+				}
+				return defaultAnswer, true
+			}
+		}
+	}
+}
+
+// With --review, the items that need a decision are listed at the end of the run, where they can be marked
+// for delete, restore, backup or leave in bulk before anything is done.
+func (kp *keyboardPrompter) Review(ctx context.Context, items []*ztbackup.ReviewItem) bool {
+	fmt.Fprintf(kp.out, "\r\n%d item(s) need a decision.\r\n", len(items))
+	printReview(kp.out, items)
+	in := bufio.NewReader(os.Stdin)
+	type readResult struct {
+		line string
+		err  error
+	}
+	for {
+		fmt.Fprintf(kp.out, "\r\nd|r|b|l ITEMS to mark for delete, restore, backup or leave (ITEMS: 1 3-7 all or a pattern)\r\n"+
+			"s path|size|date|issue to sort, p to list, a to apply, q to leave everything: ")
+		read := make(chan readResult, 1)
+		go func() {
+			line, err := in.ReadString('\n')
+			read <- readResult{line, err}
+		}()
+		var rr readResult
+		select {
+		case <-ctx.Done():
+			fmt.Fprintf(kp.out, "\r\n")
+			return false
+		case rr = <-read:
+		}
+		fields := strings.Fields(rr.line)
+		if rr.err == io.EOF && len(fields) == 0 {
+			fields = []string{"q"}
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		switch cmd := fields[0]; cmd {
+		case "a":
+			return true
+		case "q":
+			for _, ri := range items {
+				ri.Action = 'l'
+			}
+			return true
+		case "p":
+			printReview(kp.out, items)
+		case "s":
+			if len(fields) != 2 || !sortReview(items, fields[1]) {
+				fmt.Fprintf(kp.out, "Sort by path, size, date or issue\r\n")
+				continue
+			}
+			printReview(kp.out, items)
+		case "d", "r", "b", "l":
+			nSkipped, errSel := markReview(items, rune(cmd[0]), fields[1:])
+			if errSel != nil || len(fields) == 1 {
+				fmt.Fprintf(kp.out, "Which items? %v\r\n", errSel)
+				continue
+			}
+			if nSkipped != 0 {
+				fmt.Fprintf(kp.out, "%d item(s) cannot be marked %s\r\n", nSkipped, ztbackup.ReviewActionName(rune(cmd[0])))
+			}
+			printReview(kp.out, items)
+		default:
+			fmt.Fprintf(kp.out, "Unknown command '%s'\r\n", cmd)
+		}
+	}
+}
+
+func sortReview(items []*ztbackup.ReviewItem, key string) bool {
+	var less func(a, b *ztbackup.ReviewItem) bool
+	switch key {
+	case "path":
+		less = func(a, b *ztbackup.ReviewItem) bool { return a.Path() < b.Path() }
+	case "size":
+		less = func(a, b *ztbackup.ReviewItem) bool { return a.Info.Size() > b.Info.Size() }
+	case "date":
+		less = func(a, b *ztbackup.ReviewItem) bool { return a.Info.ModTime().After(b.Info.ModTime()) }
+	case "issue":
+		less = func(a, b *ztbackup.ReviewItem) bool { return a.Issue() < b.Issue() }
+	default:
+		return false
+	}
+	sort.SliceStable(items, func(i, j int) bool { return less(items[i], items[j]) })
+	return true
+}
+
+// the destination is shown when the items are from more than one
+func printReview(out io.Writer, items []*ztbackup.ReviewItem) {
+	pr := message.NewPrinter(message.MatchLanguage("en"))
+	bMixed := false
+	for _, ri := range items {
+		bMixed = bMixed || ri.Destination() != items[0].Destination()
+	}
+	fmt.Fprintf(out, "\r\n%4s  %-8s %-18s %15s  %-16s  %s\r\n", "#", "Action", "Issue", "Size", "Modified", "Path")
+	for i, ri := range items {
+		szSize := "<folder>"
+		if !ri.Info.IsDir() {
+			szSize = pr.Sprintf("%d", ri.Info.Size())
+		}
+		path := ri.Path()
+		if bMixed {
+			path += "  (" + ri.Destination() + ")"
+		}
+		fmt.Fprintf(out, "%4d  %-8s %-18s %15s  %-16s  %s\r\n", i+1, ztbackup.ReviewActionName(ri.Action), ri.Issue(), szSize,
+			ri.Info.ModTime().Format("2006-01-02 15:04"), path)
+	}
+}
+
+// marks the items selected by the tokens (see selectReview) with action. Returns the number of them it is
+// not possible for.
+func markReview(items []*ztbackup.ReviewItem, action rune, tokens []string) (int, error) {
+	sel, err := selectReview(items, tokens)
+	if err != nil {
+		return 0, err
+	}
+	nSkipped := 0
+	for _, ri := range sel {
+		if strings.ContainsRune(ri.Answers(), action) {
+			ri.Action = action
+		} else {
+			nSkipped++
+		}
+	}
+	return nSkipped, nil
+}
+
+// the items selected by the tokens: numbers, ranges (3-7), "all" or a pattern matching the path (e.g. "Photos/*")
+func selectReview(items []*ztbackup.ReviewItem, tokens []string) ([]*ztbackup.ReviewItem, error) {
+	var sel []*ztbackup.ReviewItem
+	for _, tok := range tokens {
+		if tok == "all" {
+			return items, nil
+		}
+		szLo, szHi, isRange := strings.Cut(tok, "-")
+		lo, errLo := strconv.Atoi(szLo)
+		hi, errHi := strconv.Atoi(szHi)
+		if !isRange {
+			hi, errHi = lo, errLo
+		}
+		if errLo == nil && errHi == nil {
+			if lo < 1 || hi > len(items) || lo > hi {
+				return nil, fmt.Errorf("no item %s", tok)
+			}
+			sel = append(sel, items[lo-1:hi]...)
+			continue
+		}
+		nMatched := 0
+		for _, ri := range items {
+			if ztbackup.PathMatch(tok, ri.Path()) {
+				sel = append(sel, ri)
+				nMatched++
+			}
+		}
+		if nMatched == 0 {
+			return nil, fmt.Errorf("nothing matches '%s'", tok)
+		}
+	}
+	return sel, nil
+}
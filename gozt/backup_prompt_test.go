@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gkdada/gozt/ztbackup"
+)
+
+// marks the items as the commands typed at the review would
+type commandReviewer struct {
+	ztbackup.PolicyPrompter
+	t *testing.T
+}
+
+func (cr commandReviewer) Review(ctx context.Context, items []*ztbackup.ReviewItem) bool {
+	for _, cmd := range []struct {
+		action   rune
+		tokens   []string
+		nSkipped int
+	}{
+		{'b', []string{"all"}, 2}, //only the file newer in the destination can be backed up
+		{'d', []string{"1"}, 0},
+		{'r', []string{"b-*"}, 0},
+		{'l', []string{"4"}, -1},
+	} {
+		nSkipped, err := markReview(items, cmd.action, cmd.tokens)
+		if cmd.nSkipped < 0 {
+			if err == nil {
+				cr.t.Errorf("%c %v: no error", cmd.action, cmd.tokens)
+			}
+		} else if err != nil || nSkipped != cmd.nSkipped {
+			cr.t.Errorf("%c %v: %d skipped, %v. Expected %d", cmd.action, cmd.tokens, nSkipped, err, cmd.nSkipped)
+		}
+	}
+	return true
+}
+
+func TestReviewCommands(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	src, dst := t.TempDir(), t.TempDir()
+	older, newer := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 9, 2, 0, 0, 0, 0, time.UTC)
+	for _, file := range []struct {
+		dir, name, data string
+		mod             time.Time
+	}{
+		{dst, "a-gone", "dst", newer},
+		{dst, "b-gone", "dst", newer},
+		{src, "c-newer", "source", older},
+		{dst, "c-newer", "dst", newer},
+	} {
+		fPath := filepath.Join(file.dir, file.name)
+		if err := os.WriteFile(fPath, []byte(file.data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(fPath, file.mod, file.mod)
+	}
+
+	bkp := ztbackup.Backup{Options: ztbackup.Options{FileOption: ztbackup.OptAsk, ReviewFlag: true}, Prompter: commandReviewer{t: t}}
+	if err := bkp.Run(context.Background(), src, []string{dst}, ztbackup.FolderOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "a-gone")); !os.IsNotExist(err) {
+		t.Errorf("a-gone was not deleted: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(src, "b-gone")); err != nil || string(data) != "dst" {
+		t.Errorf("b-gone was not restored: %q, %v", data, err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dst, "c-newer")); err != nil || string(data) != "source" {
+		t.Errorf("c-newer was not backed up: %q, %v", data, err)
+	}
+}
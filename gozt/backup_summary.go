@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gkdada/gozt/ztbackup"
+)
+
+// exit codes. A partial failure is a run that completed but could not copy/restore/delete some of the files.
+const (
+	exitSuccess   = 0
+	exitFatal     = 1 //nothing (or not everything) could be backed up. e.g. invalid arguments, source not readable.
+	exitPartial   = 2
+	exitLocked    = 3   //nothing was done: every destination was locked by another run
+	exitCancelled = 130 //SIGINT, SIGTERM or q at a question. Same as a shell reports for Ctrl-C.
+)
+
+// at the end of every run, a summary is written to ~/.ztbackup/last-run.json (or --summary=FILE)
+const summaryFileName = "last-run.json"
+
+type runSummary struct {
+	Command  string            `json:"command"`
+	Started  time.Time         `json:"started"`
+	Ended    time.Time         `json:"ended"`
+	ExitCode int               `json:"exit_code"`
+	Results  []ztbackup.Result `json:"results"`
+}
+
+// success if every run completed without errors, fatal if none completed, partial otherwise. Cancelled if any was,
+// locked if every destination was in use by another run.
+func exitCodeFor(results []ztbackup.Result) int {
+	nFailed, nLocked, nErrors := 0, 0, int64(0)
+	for _, res := range results {
+		if res.Cancelled {
+			return exitCancelled
+		}
+		if len(res.Error) != 0 {
+			nFailed++
+		}
+		if res.Locked {
+			nLocked++
+		}
+		nErrors += res.Statistics.NumErrors
+	}
+	switch {
+	case len(results) != 0 && nLocked == len(results):
+		return exitLocked
+	case len(results) == 0 || nFailed == len(results):
+		return exitFatal
+	case nFailed != 0 || nErrors != 0:
+		return exitPartial
+	}
+	return exitSuccess
+}
+
+// writes the summary and returns the exit code
+func writeSummary(bkp *ztbackup.Backup, szPath string, command string, started time.Time, results []ztbackup.Result) int {
+	sum := runSummary{Command: command, Started: started, Ended: time.Now(), ExitCode: exitCodeFor(results), Results: results}
+	if len(szPath) == 0 {
+		dir, err := ztbackup.ZtFolder()
+		if err != nil {
+			bkp.Printf("\rUnable to write the summary : %v\r\n", err)
+			return sum.ExitCode
+		}
+		szPath = filepath.Join(dir, summaryFileName)
+	}
+	szPath = ztbackup.ExpandHome(szPath)
+	data, _ := json.MarshalIndent(sum, "", "  ")
+	os.MkdirAll(filepath.Dir(szPath), 0755)
+	if err := os.WriteFile(szPath, append(data, '\n'), 0644); err != nil {
+		bkp.Printf("\rError writing summary %s : %v\r\n", szPath, err)
+	}
+	return sum.ExitCode
+}
@@ -0,0 +1,686 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/gkdada/gozt/ztbackup"
+)
+
+// With --tui, the backup runs in a full-screen terminal UI instead of printing line by line: the folders
+// processed so far, the file being copied, the throughput, the statistics of every destination and the
+// pending question, which can be answered for the file or for all the files in the folder.
+// The run can be paused, resumed or cancelled. When it ends, its output is shown until the user leaves.
+
+const tuiMaxLines = 10000 //of output kept for the log view
+const tuiMaxSamples = 600 //of throughput (one a second)
+const tuiRefresh = 200 * time.Millisecond
+
+type tuiView int
+
+const (
+	tuiViewRun tuiView = iota
+	tuiViewLog
+)
+
+type tuiAnswer struct {
+	ans       rune
+	defaulted bool
+}
+
+type tuiQuestion struct {
+	context []string //the lines printed before the question (which file, sizes etc.)
+	query   string
+	answers string
+	folder  string
+	def     rune
+	until   time.Time //the default is taken after this
+	reply   chan tuiAnswer
+}
+
+type ztTUI struct {
+	mu      sync.Mutex
+	screen  tcell.Screen
+	started time.Time
+
+	srcLabel string
+	dsts     []string                        //in the order of their first event
+	stats    map[string]*ztbackup.Statistics //per destination, counted from the events
+
+	folders []string //processed so far, in order
+	lines   []string //the output of the run
+	partial string   //the line being written (not ended yet)
+	crSeen  bool     //a \r that may be followed by \n
+	mark    int      //the lines from here on were printed for the next question
+
+	action  string //the file being copied or restored
+	percent int
+	overall string //with --prescan
+
+	samples     []float64 //bytes per second
+	sampleBytes int64
+	sampleStart time.Time
+
+	question      *tuiQuestion
+	folderAnswers map[string]rune //answers given for all the files in a folder
+
+	cancelRun                              context.CancelCauseFunc
+	paused, cancelled, confirmCancel, done bool
+	view                                   tuiView
+	scroll                                 int //first line shown in the log view. -1 to follow the end.
+}
+
+// the console of the run. \r returns to the start of the line, as on a terminal.
+func (tui *ztTUI) Write(p []byte) (int, error) {
+	tui.mu.Lock()
+	defer tui.mu.Unlock()
+	for _, c := range string(p) {
+		if tui.crSeen && c != '\n' {
+			tui.partial = ""
+		}
+		tui.crSeen = false
+		switch c {
+		case '\r':
+			tui.crSeen = true
+		case '\n':
+			tui.lines = append(tui.lines, tui.partial)
+			tui.partial = ""
+		default:
+			tui.partial += string(c)
+		}
+	}
+	if drop := len(tui.lines) - tuiMaxLines; drop > 0 {
+		tui.lines = tui.lines[drop:]
+		tui.mark = max(tui.mark-drop, 0)
+	}
+	return len(p), nil
+}
+
+// counts the event of its destination
+func (tui *ztTUI) event(ev ztbackup.Event) {
+	tui.mu.Lock()
+	defer tui.mu.Unlock()
+	dst := ev.Destination
+	st, ok := tui.stats[dst]
+	if !ok {
+		st = &ztbackup.Statistics{}
+		tui.stats[dst] = st
+		tui.dsts = append(tui.dsts, dst)
+	}
+	switch ev.Event {
+	case ztbackup.EvRunStart:
+		tui.srcLabel = ztbackup.FolderLabel(ev.Source)
+	case ztbackup.EvFolder:
+		st.NumFolders++
+		if len(tui.folders) == 0 || tui.folders[len(tui.folders)-1] != ev.Path {
+			tui.folders = append(tui.folders, ev.Path) //once for all the destinations
+		}
+	case ztbackup.EvCopied:
+		st.NumFilesCopied++
+		st.SizeFilesCopied += ev.Size
+	case ztbackup.EvSkipped:
+		st.NumFilesSkipped++
+		st.SizeFilesSkipped += ev.Size
+	case ztbackup.EvRestored:
+		st.NumFilesRestored++
+		st.SizeFilesRestored += ev.Size
+	case ztbackup.EvDeleted:
+		st.NumFilesDeleted++
+		st.SizeFilesDeleted += ev.Size
+	case ztbackup.EvError:
+		st.NumErrors++
+	case ztbackup.EvRunEnd:
+		if ev.Statistics != nil {
+			*st = *ev.Statistics
+		}
+	}
+	tui.mark = len(tui.lines)
+}
+
+// the file being copied (percent is -1 when finished)
+func (tui *ztTUI) Transfer(strAction string, percent int, overall string) {
+	strAction = strings.TrimPrefix(strAction, "\r")
+	tui.mu.Lock()
+	tui.action, tui.percent, tui.overall = strAction, percent, overall
+	if percent < 0 {
+		tui.action = ""
+	}
+	tui.mu.Unlock()
+	if percent < 0 {
+		fmt.Fprintf(tui, "%sdone\r\n", strAction)
+	}
+}
+
+// counts the bytes copied for the throughput. Waits while the run is paused.
+func (tui *ztTUI) Transferred(ctx context.Context, n int64) {
+	tui.mu.Lock()
+	tui.sampleBytes += n
+	tui.mu.Unlock()
+	tui.waitIfPaused(ctx)
+}
+
+func (tui *ztTUI) waitIfPaused(ctx context.Context) {
+	for ctx.Err() == nil {
+		tui.mu.Lock()
+		paused := tui.paused
+		tui.mu.Unlock()
+		if !paused {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func (tui *ztTUI) sample() {
+	tui.mu.Lock()
+	defer tui.mu.Unlock()
+	elapsed := time.Since(tui.sampleStart)
+	if elapsed < time.Second || tui.done {
+		return
+	}
+	tui.samples = append(tui.samples, float64(tui.sampleBytes)/elapsed.Seconds())
+	if len(tui.samples) > tuiMaxSamples {
+		tui.samples = tui.samples[1:]
+	}
+	tui.sampleBytes = 0
+	tui.sampleStart = time.Now()
+}
+
+func (tui *ztTUI) currentFolder() string {
+	if len(tui.folders) == 0 {
+		return ""
+	}
+	return tui.folders[len(tui.folders)-1]
+}
+
+// must be called with mu locked
+func (tui *ztTUI) answer(ans rune, defaulted bool) {
+	tui.question.reply <- tuiAnswer{ans, defaulted}
+	tui.question = nil
+}
+
+// must be called with mu locked
+func (tui *ztTUI) cancel() {
+	tui.cancelled = true
+	tui.paused = false
+	tui.cancelRun(fmt.Errorf("%w by the user", ztbackup.ErrCancelled))
+	if tui.question != nil {
+		tui.answer(tui.question.def, true)
+	}
+}
+
+// asks in the decision pane of the TUI
+type tuiPrompter struct {
+	tui        *ztTUI
+	QueryDelay time.Duration
+}
+
+func (tp *tuiPrompter) Ask(ctx context.Context, query string, answers string, defaultAnswer rune) (rune, bool) {
+	tui := tp.tui
+	if ctx.Err() != nil {
+		return defaultAnswer, true
+	}
+	tui.mu.Lock()
+	folder := tui.currentFolder()
+	if ans, ok := tui.folderAnswers[folder+"\x00"+answers]; ok {
+		tui.mu.Unlock()
+		fmt.Fprintf(tui, "%s\r\n[%c] (all in this folder)\r\n", query, ans)
+		return ans, false
+	}
+	q := &tuiQuestion{query: query, answers: answers, folder: folder, def: defaultAnswer,
+		until: time.Now().Add(tp.QueryDelay), reply: make(chan tuiAnswer, 1)}
+	q.context = append(q.context, tui.lines[min(tui.mark, len(tui.lines)):]...)
+	if len(tui.partial) != 0 {
+		q.context = append(q.context, tui.partial)
+	}
+	tui.question = q
+	tui.mu.Unlock()
+
+	timeout := time.NewTimer(tp.QueryDelay)
+	defer timeout.Stop()
+	var ta tuiAnswer
+	select {
+	case ta = <-q.reply:
+	case <-ctx.Done():
+	case <-timeout.C:
+		if tp.QueryDelay > MinHalvingDelay {
+			tp.QueryDelay = tp.QueryDelay / 2
+		}
+	}
+	if ta.ans == 0 {
+		tui.mu.Lock()
+		if tui.question == q {
+			tui.answer(defaultAnswer, true)
+		}
+		tui.mu.Unlock()
+		ta = <-q.reply
+	}
+	fmt.Fprintf(tui, "%s\r\n[%c]\r\n", query, ta.ans)
+	return ta.ans, ta.defaulted
+}
+
+// handles a key press. Returns true to leave the TUI.
+func (tui *ztTUI) key(ev *tcell.EventKey) bool {
+	tui.mu.Lock()
+	defer tui.mu.Unlock()
+
+	if tui.confirmCancel {
+		tui.confirmCancel = false
+		if ev.Rune() == 'y' || ev.Rune() == 'Y' {
+			tui.cancel()
+		}
+		return false
+	}
+	_, h := tui.screen.Size()
+	page := max(h-4, 1)
+
+	switch ev.Key() {
+	case tcell.KeyTab:
+		tui.view = 1 - tui.view
+		return false
+	case tcell.KeyCtrlC:
+		tui.confirmCancel = !tui.done
+		return false
+	case tcell.KeyEscape, tcell.KeyEnter:
+		return tui.done
+	case tcell.KeyUp:
+		tui.scrollBy(-1, page)
+		return false
+	case tcell.KeyDown:
+		tui.scrollBy(1, page)
+		return false
+	case tcell.KeyPgUp:
+		tui.scrollBy(-page, page)
+		return false
+	case tcell.KeyPgDn:
+		tui.scrollBy(page, page)
+		return false
+	case tcell.KeyHome:
+		tui.scroll = 0
+		return false
+	case tcell.KeyEnd:
+		tui.scroll = -1
+		return false
+	}
+
+	r := ev.Rune()
+	switch {
+	case r == 'q' || r == 'c':
+		if tui.done {
+			return r == 'q'
+		}
+		tui.confirmCancel = true
+	case r == 'v':
+		tui.view = 1 - tui.view
+	case (r == 'p' || r == ' ') && !tui.done:
+		tui.paused = !tui.paused
+	case tui.question != nil && strings.ContainsRune(tui.question.answers, r):
+		tui.answer(r, false)
+	case tui.question != nil && unicode.IsUpper(r) && strings.ContainsRune(tui.question.answers, unicode.ToLower(r)):
+		r = unicode.ToLower(r)
+		tui.folderAnswers[tui.question.folder+"\x00"+tui.question.answers] = r
+		tui.answer(r, false)
+	}
+	return false
+}
+
+func (tui *ztTUI) scrollBy(n int, page int) {
+	last := max(len(tui.lines)+1-page, 0)
+	if tui.scroll < 0 {
+		tui.scroll = last
+	}
+	tui.scroll += n
+	if tui.scroll >= last {
+		tui.scroll = -1
+	} else if tui.scroll < 0 {
+		tui.scroll = 0
+	}
+}
+
+func (tui *ztTUI) finish() {
+	tui.mu.Lock()
+	defer tui.mu.Unlock()
+	tui.done = true
+	tui.action = ""
+	tui.view = tuiViewLog
+	tui.scroll = -1
+}
+
+var (
+	tuiStyle      = tcell.StyleDefault
+	tuiBold       = tuiStyle.Bold(true)
+	tuiReverse    = tuiStyle.Reverse(true)
+	tuiDim        = tuiStyle.Dim(true)
+	tuiGraphStyle = tuiStyle.Foreground(tcell.ColorGreen)
+	tuiAlertStyle = tuiStyle.Foreground(tcell.ColorYellow).Bold(true)
+)
+
+// writes s at x,y. Returns the x after it.
+func (tui *ztTUI) put(x, y, width int, style tcell.Style, s string) int {
+	for _, r := range s {
+		if width <= 0 {
+			break
+		}
+		tui.screen.SetContent(x, y, r, nil, style)
+		x++
+		width--
+	}
+	return x
+}
+
+// the end of s if it is longer than width
+func tailOf(s string, width int) string {
+	r := []rune(s)
+	if len(r) <= width || width < 4 {
+		return s
+	}
+	return "..." + string(r[len(r)-width+3:])
+}
+
+func (tui *ztTUI) box(x, y, w, h int, title string) {
+	if w < 2 || h < 2 {
+		return
+	}
+	for i := x + 1; i < x+w-1; i++ {
+		tui.screen.SetContent(i, y, tcell.RuneHLine, nil, tuiDim)
+		tui.screen.SetContent(i, y+h-1, tcell.RuneHLine, nil, tuiDim)
+	}
+	for j := y + 1; j < y+h-1; j++ {
+		tui.screen.SetContent(x, j, tcell.RuneVLine, nil, tuiDim)
+		tui.screen.SetContent(x+w-1, j, tcell.RuneVLine, nil, tuiDim)
+	}
+	tui.screen.SetContent(x, y, tcell.RuneULCorner, nil, tuiDim)
+	tui.screen.SetContent(x+w-1, y, tcell.RuneURCorner, nil, tuiDim)
+	tui.screen.SetContent(x, y+h-1, tcell.RuneLLCorner, nil, tuiDim)
+	tui.screen.SetContent(x+w-1, y+h-1, tcell.RuneLRCorner, nil, tuiDim)
+	tui.put(x+2, y, w-4, tuiBold, " "+title+" ")
+}
+
+func (tui *ztTUI) draw() {
+	tui.mu.Lock()
+	defer tui.mu.Unlock()
+	tui.screen.Clear()
+	w, h := tui.screen.Size()
+	if w < 60 || h < 20 {
+		tui.put(0, 0, w, tuiStyle, "The terminal is too small for --tui (60x20)")
+		tui.screen.Show()
+		return
+	}
+	tui.drawHeader(w)
+	if tui.view == tuiViewLog {
+		tui.drawLog(0, 1, w, h-2)
+	} else {
+		const qh = 7      //decision
+		const sh = 9      //statistics
+		mid := h - 2 - qh //between the header and the decision
+		lw := w / 2
+		tui.drawFolders(0, 1, lw, mid-sh)
+		tui.drawStatistics(0, 1+mid-sh, lw, sh)
+		tui.drawTransfer(lw, 1, w-lw, 5)
+		tui.drawThroughput(lw, 6, w-lw, mid-5)
+		tui.drawQuestion(0, 1+mid, w, qh)
+	}
+	tui.drawHelp(h-1, w)
+	tui.screen.Show()
+}
+
+func (tui *ztTUI) drawHeader(w int) {
+	for x := 0; x < w; x++ {
+		tui.screen.SetContent(x, 0, ' ', nil, tuiReverse)
+	}
+	status := "Running " + time.Since(tui.started).Round(time.Second).String()
+	switch {
+	case tui.done:
+		status = "Done"
+	case tui.cancelled:
+		status = "Cancelling..."
+	case tui.paused:
+		status = "PAUSED"
+	}
+	dsts := strings.Join(tui.dsts, ", ")
+	tui.put(1, 0, w-len(status)-4, tuiReverse, tailOf("gozt  "+tui.srcLabel+" -> "+dsts, w-len(status)-4))
+	tui.put(w-len(status)-1, 0, len(status), tuiReverse.Bold(true), status)
+}
+
+func (tui *ztTUI) drawHelp(y, w int) {
+	help := "p pause/resume   c cancel   d/r/b/l answer   D/R/B/L answer for the folder   Tab output"
+	style := tuiDim
+	switch {
+	case tui.confirmCancel:
+		help = "Cancel the run? The file being copied is removed. (y/n)"
+		style = tuiAlertStyle
+	case tui.done:
+		help = "Up/Down/PgUp/PgDn scroll   Tab overview   q quit"
+	case tui.view == tuiViewLog:
+		help = "Up/Down/PgUp/PgDn scroll   End follow   Tab overview   p pause/resume   c cancel"
+	}
+	tui.put(1, y, w-2, style, help)
+}
+
+// the folders processed so far, the last one being the current
+func (tui *ztTUI) drawFolders(x, y, w, h int) {
+	if h < 3 {
+		return
+	}
+	tui.box(x, y, w, h, fmt.Sprintf("Folders (%d)", len(tui.folders)))
+	rows := h - 2
+	first := max(len(tui.folders)-rows, 0)
+	for i, path := range tui.folders[first:] {
+		name, depth := "(top)", 0
+		if len(path) != 0 {
+			name = filepath.Base(path)
+			depth = strings.Count(path, string(os.PathSeparator)) + 1
+		}
+		style := tuiStyle
+		if first+i == len(tui.folders)-1 && !tui.done {
+			style = tuiBold
+			name = "> " + name
+		} else {
+			name = "  " + name
+		}
+		tui.put(x+1, y+1+i, w-2, style, strings.Repeat("  ", depth)+name)
+	}
+}
+
+func (tui *ztTUI) drawStatistics(x, y, w, h int) {
+	tui.box(x, y, w, h, "Statistics")
+	const labelWidth = 10
+	colWidth := (w - 2 - labelWidth) / max(len(tui.dsts), 1)
+	rows := []struct {
+		label string
+		value func(st *ztbackup.Statistics) string
+	}{
+		{"Folders", func(st *ztbackup.Statistics) string { return fmt.Sprint(st.NumFolders) }},
+		{"Copied", func(st *ztbackup.Statistics) string {
+			return fmt.Sprintf("%d (%s)", st.NumFilesCopied, ztbackup.FormatBytes(st.SizeFilesCopied))
+		}},
+		{"Skipped", func(st *ztbackup.Statistics) string { return fmt.Sprint(st.NumFilesSkipped) }},
+		{"Restored", func(st *ztbackup.Statistics) string {
+			return fmt.Sprintf("%d (%s)", st.NumFilesRestored, ztbackup.FormatBytes(st.SizeFilesRestored))
+		}},
+		{"Deleted", func(st *ztbackup.Statistics) string { return fmt.Sprint(st.NumFilesDeleted) }},
+		{"Errors", func(st *ztbackup.Statistics) string { return fmt.Sprint(st.NumErrors) }},
+	}
+	for i, dst := range tui.dsts {
+		cx := x + 1 + labelWidth + i*colWidth
+		tui.put(cx, y+1, colWidth-1, tuiBold, tailOf(dst, colWidth-1))
+		for j, row := range rows {
+			style := tuiStyle
+			if row.label == "Errors" && tui.stats[dst].NumErrors != 0 {
+				style = tuiAlertStyle
+			}
+			tui.put(cx, y+2+j, colWidth-1, style, row.value(tui.stats[dst]))
+		}
+	}
+	for j, row := range rows {
+		tui.put(x+1, y+2+j, labelWidth, tuiStyle, row.label)
+	}
+}
+
+func (tui *ztTUI) drawTransfer(x, y, w, h int) {
+	tui.box(x, y, w, h, "Transfer")
+	if len(tui.action) == 0 {
+		tui.put(x+2, y+1, w-4, tuiDim, "idle")
+	} else {
+		tui.put(x+2, y+1, w-4, tuiStyle, tailOf(tui.action, w-4))
+		barWidth := w - 10
+		filled := barWidth * tui.percent / 100
+		bar := strings.Repeat("#", filled) + strings.Repeat(".", barWidth-filled)
+		tui.put(x+2, y+2, w-4, tuiGraphStyle, fmt.Sprintf("%s %3d%%", bar, tui.percent))
+	}
+	if len(tui.overall) != 0 {
+		tui.put(x+2, y+3, w-4, tuiStyle, tui.overall)
+	}
+}
+
+var tuiBlocks = []rune(" ▁▂▃▄▅▆▇█")
+
+func (tui *ztTUI) drawThroughput(x, y, w, h int) {
+	samples := tui.samples
+	if len(samples) > w-2 {
+		samples = samples[len(samples)-(w-2):]
+	}
+	current, peak := 0.0, 0.0
+	for _, s := range samples {
+		peak = max(peak, s)
+	}
+	if len(samples) != 0 {
+		current = samples[len(samples)-1]
+	}
+	tui.box(x, y, w, h, fmt.Sprintf("Throughput %s/s (peak %s/s)", ztbackup.FormatBytes(int64(current)), ztbackup.FormatBytes(int64(peak))))
+	rows := h - 2
+	if peak == 0 || rows < 1 {
+		return
+	}
+	for i, s := range samples {
+		eighths := int(s/peak*float64(rows*8) + 0.5)
+		for r := 0; r < rows && eighths > r*8; r++ {
+			level := min(eighths-r*8, 8)
+			tui.screen.SetContent(x+1+i, y+h-2-r, tuiBlocks[level], nil, tuiGraphStyle)
+		}
+	}
+}
+
+func (tui *ztTUI) drawQuestion(x, y, w, h int) {
+	q := tui.question
+	if q == nil {
+		tui.box(x, y, w, h, "Decision")
+		tui.put(x+2, y+1, w-4, tuiDim, "No decision pending")
+		return
+	}
+	tui.box(x, y, w, h, "Decision needed")
+	context := q.context
+	if n := h - 4; len(context) > n {
+		context = context[len(context)-n:]
+	}
+	row := y + 1
+	for _, line := range context {
+		tui.put(x+2, row, w-4, tuiStyle, line)
+		row++
+	}
+	tui.put(x+2, row, w-4, tuiBold, q.query)
+	var keys, folderKeys []string
+	for _, ans := range q.answers {
+		keys = append(keys, string(ans))
+		folderKeys = append(folderKeys, strings.ToUpper(string(ans)))
+	}
+	folder := q.folder
+	if len(folder) == 0 {
+		folder = "(top)"
+	}
+	tui.put(x+2, y+h-2, w-4, tuiAlertStyle, fmt.Sprintf("%s: this item   %s: everything in %s   [%c] in %d seconds",
+		strings.Join(keys, "/"), strings.Join(folderKeys, "/"), tailOf(folder, 30), q.def, int(time.Until(q.until).Seconds())))
+}
+
+// the output of the run, scrollable
+func (tui *ztTUI) drawLog(x, y, w, h int) {
+	lines := tui.lines
+	if len(tui.partial) != 0 {
+		lines = append(lines[:len(lines):len(lines)], tui.partial)
+	}
+	rows := h - 2
+	first := tui.scroll
+	if first < 0 || first > len(lines)-rows {
+		first = max(len(lines)-rows, 0)
+	}
+	title := "Output"
+	if tui.done {
+		title = "Output of the run"
+	}
+	tui.box(x, y, w, h, fmt.Sprintf("%s (%d-%d of %d)", title, min(first+1, len(lines)), min(first+rows, len(lines)), len(lines)))
+	for i := 0; i < rows && first+i < len(lines); i++ {
+		tui.put(x+1, y+1+i, w-2, tuiStyle, lines[first+i])
+	}
+}
+
+// runs the backup (run) in the TUI, until the user leaves after the end of the run.
+func runWithTUI(ctx context.Context, bkp *ztbackup.Backup, run func(ctx context.Context) error) error {
+	screen, err := tcell.NewScreen()
+	if err != nil {
+		return err
+	}
+	if err = screen.Init(); err != nil {
+		return err
+	}
+	tui := &ztTUI{screen: screen, started: time.Now(), sampleStart: time.Now(), scroll: -1,
+		stats: make(map[string]*ztbackup.Statistics), folderAnswers: make(map[string]rune)}
+	ctx, tui.cancelRun = context.WithCancelCause(ctx)
+	defer tui.cancelRun(nil)
+	console, onEvent, display, prompter := bkp.Console, bkp.OnEvent, bkp.Display, bkp.Prompter
+	bkp.Console, bkp.OnEvent, bkp.Display = tui, tui.event, tui
+	if _, ok := bkp.Prompter.(*keyboardPrompter); ok || bkp.Prompter == nil {
+		bkp.Prompter = &tuiPrompter{tui: tui, QueryDelay: StdQueryDelay}
+	}
+	log.SetOutput(tui) //the backends report some things through log
+
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				screen.Fini() //or the terminal is left unusable
+				panic(r)
+			}
+		}()
+		done <- run(ctx)
+	}()
+	events := make(chan tcell.Event, 10)
+	go func() {
+		for ev := screen.PollEvent(); ev != nil; ev = screen.PollEvent() {
+			events <- ev
+		}
+	}()
+
+	ticker := time.NewTicker(tuiRefresh)
+	defer ticker.Stop()
+	var runErr error
+	for quit := false; !quit; {
+		select {
+		case ev := <-events:
+			switch ev := ev.(type) {
+			case *tcell.EventKey:
+				quit = tui.key(ev)
+			case *tcell.EventResize:
+				screen.Sync()
+			}
+		case <-ticker.C:
+			tui.sample()
+		case runErr = <-done:
+			tui.finish()
+		}
+		tui.draw()
+	}
+	screen.Fini()
+	log.SetOutput(os.Stderr)
+
+	bkp.Console, bkp.OnEvent, bkp.Display, bkp.Prompter = console, onEvent, display, prompter
+	bkp.Printf("%s", bkp.StatisticsText())
+	return runErr
+}
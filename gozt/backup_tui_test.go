@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/gkdada/gozt/ztbackup"
+)
+
+func newTestTUI() *ztTUI {
+	screen := tcell.NewSimulationScreen("")
+	screen.Init()
+	return &ztTUI{screen: screen, started: time.Now(), scroll: -1,
+		stats: make(map[string]*ztbackup.Statistics), folderAnswers: make(map[string]rune)}
+}
+
+func TestTUIWrite(t *testing.T) {
+	tui := newTestTUI()
+	fmt.Fprintf(tui, "\rScanning the source...")
+	fmt.Fprintf(tui, "\r3 file(s) to copy\r")
+	fmt.Fprintf(tui, "\nCopying a...done\r\n")
+	if len(tui.lines) != 2 || tui.lines[0] != "3 file(s) to copy" || tui.lines[1] != "Copying a...done" || len(tui.partial) != 0 {
+		t.Errorf("unexpected lines %q, partial %q", tui.lines, tui.partial)
+	}
+}
+
+func TestTUIFolderAnswer(t *testing.T) {
+	tui := newTestTUI()
+	ctx, cancel := context.WithCancelCause(context.Background())
+	tui.cancelRun = cancel
+	tp := &tuiPrompter{tui: tui, QueryDelay: time.Minute}
+	tui.event(ztbackup.Event{Event: ztbackup.EvFolder, Destination: "dst", Path: "Photos"})
+
+	go func() {
+		for {
+			tui.mu.Lock()
+			asked := tui.question != nil
+			tui.mu.Unlock()
+			if asked {
+				tui.key(tcell.NewEventKey(tcell.KeyRune, 'D', tcell.ModShift))
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	if ans, defaulted := tp.Ask(ctx, "?", "drl", 'l'); ans != 'd' || defaulted {
+		t.Errorf("first question: got %c %v", ans, defaulted)
+	}
+	//the rest of the folder is not asked
+	if ans, _ := tp.Ask(ctx, "?", "drl", 'l'); ans != 'd' {
+		t.Errorf("same folder: got %c", ans)
+	}
+	tui.event(ztbackup.Event{Event: ztbackup.EvFolder, Destination: "dst", Path: "Music"})
+	tui.mu.Lock()
+	tui.cancel()
+	tui.mu.Unlock()
+	if ans, defaulted := tp.Ask(ctx, "?", "drl", 'l'); ans != 'l' || !defaulted {
+		t.Errorf("cancelled: got %c %v", ans, defaulted)
+	}
+}
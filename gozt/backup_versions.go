@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gkdada/gozt/ztbackup"
+)
+
+// gozt restore [--as-of="YYYY-MM-DD HH:MM"] backup-folder target-folder
+// returns the exit code
+func cmdRestore(ctx context.Context, bkp *ztbackup.Backup, params []string, opts map[string]string) int {
+	asOf := time.Now()
+	if szAsOf, ok := opts["as-of"]; ok {
+		var err error
+		if asOf, err = ztbackup.ParseAsOf(szAsOf); err != nil {
+			Fatalln(err.Error())
+		}
+	}
+	if len(params) != 2 {
+		Fatalln("Expecting backup folder/URL and target folder/URL for restore")
+	}
+
+	started := time.Now()
+	err := bkp.Restore(ctx, params[0], params[1], asOf, ztbackup.FolderOptions{SshKey: opts["ssh-key"]})
+	return writeSummary(bkp, opts["summary"], "restore", started, bkp.Results(err))
+}
+
+// gozt list-versions backup-folder path/to/file
+func cmdListVersions(bkp *ztbackup.Backup, params []string) {
+	if len(params) != 2 {
+		Fatalln("Expecting backup folder/URL and the path of the file (relative to the backup folder)")
+	}
+	bkps, err := ztbackup.Initialize(params[0], nil)
+	if err != nil {
+		Fatalln(err.Error())
+	}
+	defer bkps.Close()
+
+	if err := bkp.ListVersions(bkps, strings.Trim(params[1], string(os.PathSeparator))); err != nil {
+		bkps.Close()
+		Fatalln(err.Error())
+	}
+}
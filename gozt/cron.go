@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cron-like schedules for jobs: "minute hour day-of-month month day-of-week", with *, lists (1,15),
+// ranges (1-5), steps (*/15, 0-30/10) and the usual shortcuts (@hourly, @daily, @weekly, @monthly).
+// As with cron, if both day-of-month and day-of-week are restricted, either one matching is enough.
+type cronSchedule struct {
+	fields  [5]string
+	minute  uint64
+	hour    uint64
+	dom     uint64
+	month   uint64
+	dow     uint64
+	domStar bool
+	dowStar bool
+}
+
+var cronShortcuts = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+	"@yearly":   "0 0 1 1 *",
+}
+
+var cronBounds = [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+
+func parseCron(expr string) (*cronSchedule, error) {
+	expr = strings.TrimSpace(expr)
+	if full, ok := cronShortcuts[expr]; ok {
+		expr = full
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid schedule '%s'. Expecting 5 fields: minute hour day-of-month month day-of-week", expr)
+	}
+
+	var cs cronSchedule
+	var bits [5]uint64
+	for i, field := range fields {
+		b, err := parseCronField(field, cronBounds[i][0], cronBounds[i][1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule '%s': %v", expr, err)
+		}
+		bits[i] = b
+		cs.fields[i] = field
+	}
+	cs.minute, cs.hour, cs.dom, cs.month, cs.dow = bits[0], bits[1], bits[2], bits[3], bits[4]
+	if cs.dow&(1<<7) != 0 { //7 is Sunday as well
+		cs.dow |= 1
+	}
+	cs.domStar = fields[2] == "*"
+	cs.dowStar = fields[4] == "*"
+	return &cs, nil
+}
+
+func parseCronField(field string, min int, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, szStep, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(szStep)
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step '%s'", szStep)
+			}
+		}
+		lo, hi := min, max
+		if rng != "*" {
+			szLo, szHi, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = strconv.Atoi(szLo); err != nil {
+				return 0, fmt.Errorf("invalid value '%s'", szLo)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(szHi); err != nil {
+					return 0, fmt.Errorf("invalid value '%s'", szHi)
+				}
+			} else if hasStep {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("'%s' out of range %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func (cs *cronSchedule) dayMatches(t time.Time) bool {
+	domOk := cs.dom&(1<<t.Day()) != 0
+	dowOk := cs.dow&(1<<int(t.Weekday())) != 0
+	if cs.domStar || cs.dowStar {
+		return domOk && dowOk
+	}
+	return domOk || dowOk
+}
+
+// the first time (to the minute) after t that matches the schedule. Zero if there is none within 5 years.
+func (cs *cronSchedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if cs.month&(1<<int(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !cs.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if cs.hour&(1<<t.Hour()) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if cs.minute&(1<<t.Minute()) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+var systemdWeekdays = []string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat", "Sun"}
+
+// converts the schedule to a systemd OnCalendar= expression. Not every cron expression has one.
+func (cs *cronSchedule) OnCalendar() (string, error) {
+	if !cs.domStar && !cs.dowStar {
+		return "", fmt.Errorf("systemd cannot match day-of-month OR day-of-week")
+	}
+	var conv [5]string
+	for i, field := range cs.fields {
+		var parts []string
+		for _, part := range strings.Split(field, ",") {
+			rng, szStep, hasStep := strings.Cut(part, "/")
+			lo, hi, isRange := strings.Cut(rng, "-")
+			if i == 4 {
+				if rng == "*" && !hasStep {
+					parts = append(parts, "*")
+					continue
+				}
+				if hasStep || rng == "*" {
+					return "", fmt.Errorf("systemd does not support steps in day-of-week")
+				}
+				nLo, _ := strconv.Atoi(lo)
+				day := systemdWeekdays[nLo]
+				if isRange {
+					nHi, _ := strconv.Atoi(hi)
+					day += ".." + systemdWeekdays[nHi]
+				}
+				parts = append(parts, day)
+				continue
+			}
+			switch {
+			case isRange && hasStep:
+				return "", fmt.Errorf("systemd does not support stepped ranges ('%s')", part)
+			case isRange:
+				parts = append(parts, lo+".."+hi)
+			case hasStep && rng == "*":
+				parts = append(parts, strconv.Itoa(cronBounds[i][0])+"/"+szStep)
+			default:
+				parts = append(parts, part)
+			}
+		}
+		conv[i] = strings.Join(parts, ",")
+	}
+	// systemd: DayOfWeek Year-Month-Day Hour:Minute:Second
+	onCal := fmt.Sprintf("*-%s-%s %s:%s:00", conv[3], conv[2], conv[1], conv[0])
+	if conv[4] != "*" {
+		onCal = conv[4] + " " + onCal
+	}
+	return onCal, nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	from := time.Date(2026, 9, 1, 14, 7, 30, 0, time.UTC) //a Tuesday
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"*/15 * * * *", time.Date(2026, 9, 1, 14, 15, 0, 0, time.UTC)},
+		{"@daily", time.Date(2026, 9, 2, 0, 0, 0, 0, time.UTC)},
+		{"30 2 * * 1-5", time.Date(2026, 9, 2, 2, 30, 0, 0, time.UTC)},
+		{"0 3 * * 0", time.Date(2026, 9, 6, 3, 0, 0, 0, time.UTC)},
+		{"0 3 * * 7", time.Date(2026, 9, 6, 3, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 15 * 5", time.Date(2026, 9, 4, 0, 0, 0, 0, time.UTC)}, //day-of-month OR day-of-week
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		cs, err := parseCron(tt.expr)
+		if err != nil {
+			t.Errorf("parseCron(%q): %v", tt.expr, err)
+			continue
+		}
+		if got := cs.Next(from); !got.Equal(tt.want) {
+			t.Errorf("%q: Next = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestCronInvalid(t *testing.T) {
+	for _, expr := range []string{"* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *"} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("parseCron(%q) should fail", expr)
+		}
+	}
+}
+
+func TestCronOnCalendar(t *testing.T) {
+	tests := map[string]string{
+		"30 2 * * 1-5":   "Mon..Fri *-*-* 2:30:00",
+		"*/15 * * * *":   "*-*-* *:0/15:00",
+		"0 0 1,15 * *":   "*-*-1,15 0:0:00",
+		"0 22 * 6-8 0,6": "Sun,Sat *-6..8-* 22:0:00",
+	}
+	for expr, want := range tests {
+		cs, _ := parseCron(expr)
+		got, err := cs.OnCalendar()
+		if err != nil || got != want {
+			t.Errorf("%q: OnCalendar = %q (%v), want %q", expr, got, err, want)
+		}
+	}
+}
+
+func TestCrontabLine(t *testing.T) {
+	cs, err := parseCron("30 2 * * 1-5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sj := scheduledJob{job: &ztJob{Name: "pictures"}, schedule: cs, jitter: 10 * time.Minute}
+	got := crontabLine(sj, "/usr/bin/gozt run --config='/home/me/100%/jobs.toml' pictures", "/home/me/.ztbackup/cron.log")
+	want := `30 2 * * 1-5 /usr/bin/gozt run --config='/home/me/100\%/jobs.toml' pictures --jitter=10m0s >> /home/me/.ztbackup/cron.log 2>&1 # gozt:pictures`
+	if got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
@@ -3,16 +3,23 @@ module github.com/gkdada/gozt
 go 1.21
 
 require (
+	github.com/BurntSushi/toml v1.3.2
 	github.com/eiannone/keyboard v0.0.0-20220611211555-0d226195f203
+	github.com/gdamore/tcell/v2 v2.6.0
 	github.com/hirochachacha/go-smb2 v1.1.0
 	github.com/pkg/sftp v1.13.6
 	github.com/tzvetkoff-go/fnmatch v0.0.0-20220210160758-879480b5e662
 	golang.org/x/crypto v0.17.0
+	golang.org/x/sys v0.15.0
+	golang.org/x/term v0.15.0
 	golang.org/x/text v0.14.0
 )
 
 require (
+	github.com/gdamore/encoding v1.0.0 // indirect
 	github.com/geoffgarside/ber v1.1.0 // indirect
 	github.com/kr/fs v0.1.0 // indirect
-	golang.org/x/sys v0.15.0 // indirect
+	github.com/lucasb-eyer/go-colorful v1.2.0 // indirect
+	github.com/mattn/go-runewidth v0.0.14 // indirect
+	github.com/rivo/uniseg v0.4.3 // indirect
 )
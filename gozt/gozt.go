@@ -1,9 +1,17 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
+
+	"github.com/gkdada/gozt/ztbackup"
+	"golang.org/x/term"
 )
 
 type VersionInfo struct {
@@ -21,51 +29,214 @@ func Fatalln(line string) {
 	os.Exit(1)
 }
 
+// cancelled on SIGINT or SIGTERM. The run stops after removing the file being copied, closes the
+// connections and logs the statistics so far. A second signal exits right away.
+// The cancel function is returned for q at a question.
+func signalContext() (context.Context, context.CancelCauseFunc) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-sigs
+		cancel(fmt.Errorf("%w (%v)", ztbackup.ErrCancelled, sig))
+		<-sigs
+		os.Exit(exitCancelled)
+	}()
+	return ctx, cancel
+}
+
+// options in the form of --name=value or --name value. Anything else starting with '--' is a switch.
+var longValueOptions = map[string]bool{
+	"as-of":           true,
+	"config":          true,
+	"ssh-key":         true,
+	"bwlimit":         true,
+	"quota":           true,
+	"space-check":     true,
+	"interval":        true,
+	"jitter":          true,
+	"output":          true,
+	"log-dir":         true,
+	"log-rotate":      true,
+	"log-keep":        true,
+	"summary":         true,
+	"answers":         true,
+	"non-interactive": true,
+}
+
+// separates the flags (-a, -r etc. into opts) from the string parameters and long options
+func parseArgs(bkp *ztbackup.Backup, args []string) ([]string, map[string]string) {
+	var params []string
+	opts := make(map[string]string)
+
+	for i := 0; i < len(args); i++ {
+		ctr := args[i]
+		if strings.HasPrefix(ctr, "--") {
+			name, value, hasValue := strings.Cut(ctr[2:], "=")
+			if longValueOptions[name] && !hasValue {
+				if i+1 >= len(args) {
+					bkp.LogPrintf("\r\nMissing value for option --%s\r\n", name)
+					os.Exit(1)
+				}
+				i++
+				value = args[i]
+			}
+			opts[name] = value
+		} else if len(ctr) > 1 && ctr[0] == '-' {
+			processFlags(&bkp.Options, ctr)
+		} else {
+			params = append(params, ctr)
+		}
+	}
+	return params, opts
+}
+
+func processFlags(opts *ztbackup.Options, flags string) {
+	for _, ctr := range flags {
+		switch ctr {
+		case 'a':
+			opts.FileOption = ztbackup.OptAsk
+		case 'b':
+			opts.FolderOption = ztbackup.OptAsk
+		case 'l':
+			opts.FileOption = ztbackup.OptLeave
+		case 'm':
+			opts.FolderOption = ztbackup.OptLeave
+		case 'd':
+			opts.FileOption = ztbackup.OptDelete
+		case 'e':
+			opts.FolderOption = ztbackup.OptDelete
+		case 'r':
+			opts.RecursiveFlag = true
+		case 'v':
+			opts.VersionFlag = true
+
+		}
+	}
+}
+
 func main() {
 	//backups.Ssh_init()
 	//backups.Smb_init()
 
-	var Src, Dst string
+	var bkp ztbackup.Backup
 
-	var bkp Backup
+	args := os.Args[1:]
+	command := ""
+	if len(args) != 0 {
+		switch args[0] {
+		case "restore", "list-versions", "find", "run", "watch", "sync", "schedule", "daemon":
+			command = args[0]
+			args = args[1:]
+		}
+	}
 
-	vi := VerInfo()
-	bkp.LogPrintf("gozt - ztbackup on Go. ver. %d.%d.%d (c) 2023 Gopal Sagar\r\n", vi.major, vi.minor, vi.revision)
+	bkp.Console = os.Stdout
+	params, opts := parseArgs(&bkp, args)
+
+	switch opts["output"] {
+	case "", "text":
+	case "json":
+		//the events go to stdout, one JSON object per line. Everything else goes to stderr.
+		bkp.Console = os.Stderr
+		enc := json.NewEncoder(os.Stdout)
+		bkp.OnEvent = func(ev ztbackup.Event) { enc.Encode(ev) }
+	default:
+		Fatalln("Invalid --output. Expecting text or json")
+	}
 
-	for i, ctr := range os.Args {
-		if i == 0 {
-			//skip. this is the program name
-		} else if ctr[0] == '-' {
-			bkp.ProcessFlags(ctr)
-		} else if len(Src) == 0 {
-			Src = ctr
-		} else if len(Dst) == 0 {
-			Dst = ctr
+	if err := bkp.Log.Configure(opts["log-dir"], opts["log-rotate"], opts["log-keep"]); err != nil {
+		Fatalln(err.Error())
+	}
+
+	_, bkp.PrescanFlag = opts["prescan"]
+	_, bkp.ReviewFlag = opts["review"]
+	_, bkp.BreakLock = opts["break-lock"]
+	_, bkp.RescanFlag = opts["rescan"]
+	_, bkp.ReflinkFlag = opts["reflink"]
+	ctx, cancel := signalContext()
+	var err error
+	if bkp.Prompter, err = newPrompter(bkp.Console, cancel, opts["answers"], opts["non-interactive"]); err != nil {
+		Fatalln(err.Error())
+	}
+	//for the jobs as well, unless they have their own
+	if bkp.SpaceCheck, err = ztbackup.ParseSpaceCheck(opts["space-check"]); err != nil {
+		Fatalln(err.Error())
+	}
+	if szQuota, ok := opts["quota"]; ok {
+		if strings.Contains(szQuota, "=") {
+			bkp.Quotas, err = ztbackup.ParseDestQuotas(szQuota)
 		} else {
-			bkp.LogPrintf("\r\nToo many string parameters (%s). Expecting only source, destination and flags", ctr)
-			os.Exit(1)
+			bkp.Quota, bkp.QuotaPercent, err = ztbackup.ParseQuota(szQuota)
 		}
+		if err != nil {
+			Fatalln(err.Error())
+		}
+	}
+
+	vi := VerInfo()
+	bkp.LogPrintf("gozt - ztbackup on Go. ver. %d.%d.%d (c) 2023 Gopal Sagar\r\n", vi.major, vi.minor, vi.revision)
+
+	switch command {
+	case "restore":
+		os.Exit(cmdRestore(ctx, &bkp, params, opts))
+	case "list-versions":
+		cmdListVersions(&bkp, params)
+	case "find":
+		cmdFind(&bkp, params)
+	case "run":
+		os.Exit(cmdRun(ctx, &bkp, params, opts))
+	case "watch":
+		os.Exit(cmdWatch(ctx, &bkp, opts))
+	case "schedule":
+		os.Exit(cmdSchedule(params, opts))
+	case "daemon":
+		os.Exit(cmdDaemon(ctx, &bkp, opts))
+	case "sync":
+		_, bkp.WatchFlag = opts["watch"]
+		os.Exit(cmdBackup(ctx, &bkp, params, opts))
+	default:
+		os.Exit(cmdBackup(ctx, &bkp, params, opts))
 	}
+}
 
-	if len(Src) == 0 {
+// the default command: gozt [flags] source destination [destination...]
+// returns the exit code
+func cmdBackup(ctx context.Context, bkp *ztbackup.Backup, params []string, opts map[string]string) int {
+
+	if len(params) == 0 {
 		bkp.LogPrintf("\r\nMissing source folder/URL")
 		os.Exit(1)
-	} else if len(Dst) == 0 {
+	} else if len(params) == 1 {
 		bkp.LogPrintf("\r\nMissing destination folder/URL")
 		os.Exit(1)
 	}
 
-	bkp.LogPrintf("Initiating zero-touch backup at %s\r\n", time.Now().Format(time.UnixDate))
-	bkp.LogPrintf("Source Folder: %s\r\n", Src)
-	bkp.LogPrintf("Destination Folder: %s\r\n", Dst)
-
-	srcBack := Initialize(Src, nil)
-
-	dstBack := Initialize(Dst, srcBack)
-
-	defer srcBack.Close()
-	defer dstBack.Close()
-
-	bkp.StartBackup(&srcBack, &dstBack)
+	if szLimit, ok := opts["bwlimit"]; ok {
+		limit, err := ztbackup.ParseByteSize(szLimit)
+		if err != nil {
+			Fatalln(err.Error())
+		}
+		bkp.BandwidthLimit = limit
+	}
+	var err error
 
+	run := func(ctx context.Context) error {
+		return bkp.Run(ctx, params[0], params[1:], ztbackup.FolderOptions{SshKey: opts["ssh-key"]})
+	}
+	started := time.Now()
+	if _, ok := opts["tui"]; ok {
+		switch {
+		case bkp.OnEvent != nil:
+			Fatalln("--tui cannot be combined with --output=json")
+		case bkp.WatchFlag:
+			Fatalln("--tui cannot be combined with sync --watch")
+		case !term.IsTerminal(int(os.Stdout.Fd())):
+			Fatalln("--tui needs a terminal")
+		}
+		err = runWithTUI(ctx, bkp, run)
+	} else {
+		err = run(ctx)
+	}
+	return writeSummary(bkp, opts["summary"], "backup", started, bkp.Results(err))
 }
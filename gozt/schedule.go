@@ -0,0 +1,392 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gkdada/gozt/ztbackup"
+)
+
+// Jobs with a schedule (see jobs.toml) can be run either by systemd user timers or crontab entries
+// generated with "gozt schedule install", or by gozt itself with "gozt daemon".
+const daemonStateFile = "daemon.json"
+const daemonTick = 30 * time.Second //the clock is checked this often. catches up after a suspend.
+const cronTag = "# gozt:"
+const unitPrefix = "gozt-"
+
+type scheduledJob struct {
+	job      *ztJob
+	schedule *cronSchedule
+	jitter   time.Duration
+}
+
+func getScheduledJobs(jf *ztJobFile) ([]scheduledJob, error) {
+	var jobs []scheduledJob
+	for i := range jf.Jobs {
+		job := &jf.Jobs[i]
+		if len(job.Schedule) == 0 {
+			continue
+		}
+		cs, err := parseCron(job.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("job '%s': %v", job.Name, err)
+		}
+		sj := scheduledJob{job: job, schedule: cs}
+		if len(job.Jitter) != 0 {
+			if sj.jitter, err = time.ParseDuration(job.Jitter); err != nil {
+				return nil, fmt.Errorf("job '%s': invalid jitter '%s'", job.Name, job.Jitter)
+			}
+		}
+		jobs = append(jobs, sj)
+	}
+	return jobs, nil
+}
+
+// the command line that runs a single job
+func jobCommandLine(cfgPath string, name string) (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s run --config=%s %s", shellQuote(exe), shellQuote(cfgPath), shellQuote(name)), nil
+}
+
+func shellQuote(s string) string {
+	if !strings.ContainsAny(s, " \t'\"\\$`;&|<>()*?[]#~%") {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func systemdUnitFolder() string {
+	cfg, err := os.UserConfigDir()
+	if err != nil {
+		cfg = ztbackup.ExpandHome("~/.config")
+	}
+	return filepath.Join(cfg, "systemd", "user")
+}
+
+func hasSystemd() bool {
+	if runtime.GOOS != "linux" {
+		return false
+	}
+	return exec.Command("systemctl", "--user", "show-environment").Run() == nil
+}
+
+func installSystemdUnits(cfgPath string, jobs []scheduledJob) error {
+	unitDir := systemdUnitFolder()
+	if err := os.MkdirAll(unitDir, 0755); err != nil {
+		return err
+	}
+	for _, sj := range jobs {
+		onCal, err := sj.schedule.OnCalendar()
+		if err != nil {
+			return fmt.Errorf("job '%s': %v (use --crontab or gozt daemon)", sj.job.Name, err)
+		}
+		cmdLine, err := jobCommandLine(cfgPath, sj.job.Name)
+		if err != nil {
+			return err
+		}
+		unit := unitPrefix + sj.job.Name
+		service := fmt.Sprintf("[Unit]\nDescription=gozt backup job %s\nAfter=network-online.target\n\n"+
+			"[Service]\nType=oneshot\nEnvironment=HOME=%%h\nExecStart=%s\nStandardOutput=journal\nStandardError=journal\nNice=10\nIOSchedulingClass=idle\n",
+			sj.job.Name, strings.ReplaceAll(cmdLine, "%", "%%"))
+		timer := fmt.Sprintf("[Unit]\nDescription=Run gozt backup job %s\n\n[Timer]\nOnCalendar=%s\nPersistent=true\nRandomizedDelaySec=%d\n\n[Install]\nWantedBy=timers.target\n",
+			sj.job.Name, onCal, int(sj.jitter.Seconds()))
+
+		if err := os.WriteFile(filepath.Join(unitDir, unit+".service"), []byte(service), 0644); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(unitDir, unit+".timer"), []byte(timer), 0644); err != nil {
+			return err
+		}
+		fmt.Printf("Installed %s.timer (%s)\r\n", unit, onCal)
+	}
+	if err := exec.Command("systemctl", "--user", "daemon-reload").Run(); err != nil {
+		return err
+	}
+	for _, sj := range jobs {
+		out, err := exec.Command("systemctl", "--user", "enable", "--now", unitPrefix+sj.job.Name+".timer").CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("enabling %s%s.timer: %v %s", unitPrefix, sj.job.Name, err, out)
+		}
+	}
+	return nil
+}
+
+func removeSystemdUnits() error {
+	units, _ := filepath.Glob(filepath.Join(systemdUnitFolder(), unitPrefix+"*.timer"))
+	for _, timer := range units {
+		exec.Command("systemctl", "--user", "disable", "--now", filepath.Base(timer)).Run()
+		os.Remove(timer)
+		os.Remove(strings.TrimSuffix(timer, ".timer") + ".service")
+		fmt.Printf("Removed %s\r\n", filepath.Base(timer))
+	}
+	return exec.Command("systemctl", "--user", "daemon-reload").Run()
+}
+
+func readCrontab() []string {
+	out, err := exec.Command("crontab", "-l").Output()
+	if err != nil {
+		return nil //no crontab yet
+	}
+	return strings.Split(strings.TrimRight(string(out), "\n"), "\n")
+}
+
+func writeCrontab(lines []string) error {
+	cmd := exec.Command("crontab", "-")
+	cmd.Stdin = bytes.NewBufferString(strings.Join(lines, "\n") + "\n")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("crontab: %v %s", err, out)
+	}
+	return nil
+}
+
+// the lines of the crontab that were not added by gozt
+func foreignCrontabLines() []string {
+	var kept []string
+	for _, line := range readCrontab() {
+		if !strings.Contains(line, cronTag) {
+			kept = append(kept, line)
+		}
+	}
+	return kept
+}
+
+// a random delay of up to jitter
+func jitterDelay(jitter time.Duration) time.Duration {
+	if jitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(jitter)))
+}
+
+// the crontab entry of a job. The jitter is left to gozt run. cron takes a % for a new line unless it is escaped.
+func crontabLine(sj scheduledJob, cmdLine string, logFile string) string {
+	if sj.jitter > 0 {
+		cmdLine += " --jitter=" + sj.jitter.String()
+	}
+	entry := fmt.Sprintf("%s >> %s 2>&1 %s%s", cmdLine, shellQuote(logFile), cronTag, sj.job.Name)
+	return strings.Join(sj.schedule.fields[:], " ") + " " + strings.ReplaceAll(entry, "%", `\%`)
+}
+
+func installCrontab(cfgPath string, jobs []scheduledJob) error {
+	lines := foreignCrontabLines()
+	dir, err := ztbackup.ZtFolder()
+	if err != nil {
+		return err
+	}
+	logFile := filepath.Join(dir, "cron.log")
+	for _, sj := range jobs {
+		cmdLine, err := jobCommandLine(cfgPath, sj.job.Name)
+		if err != nil {
+			return err
+		}
+		lines = append(lines, crontabLine(sj, cmdLine, logFile))
+		fmt.Printf("Added crontab entry for %s\r\n", sj.job.Name)
+	}
+	return writeCrontab(lines)
+}
+
+// gozt schedule (install [--crontab] | remove | list) [--config file]
+func cmdSchedule(params []string, opts map[string]string) int {
+	cfgPath, err := getJobFilePath(opts)
+	if err != nil {
+		fmt.Printf("Unable to find the jobs : %v\r\n", err)
+		return 1
+	}
+	cfgPath, _ = filepath.Abs(ztbackup.ExpandHome(cfgPath))
+
+	action := "list"
+	if len(params) != 0 {
+		action = params[0]
+	}
+
+	switch action {
+	case "install":
+		jf, errLoad := loadJobFile(cfgPath, "")
+		if errLoad != nil {
+			fmt.Printf("Error loading jobs from %s : %v\r\n", cfgPath, errLoad)
+			return 1
+		}
+		jobs, errJobs := getScheduledJobs(jf)
+		if errJobs != nil {
+			fmt.Printf("%v\r\n", errJobs)
+			return 1
+		}
+		if len(jobs) == 0 {
+			fmt.Printf("No job in %s has a schedule\r\n", cfgPath)
+			return 1
+		}
+		_, useCron := opts["crontab"]
+		if !useCron && hasSystemd() {
+			err = installSystemdUnits(cfgPath, jobs)
+		} else {
+			err = installCrontab(cfgPath, jobs)
+		}
+	case "remove":
+		if hasSystemd() {
+			err = removeSystemdUnits()
+		}
+		if lines := readCrontab(); lines != nil {
+			if errCron := writeCrontab(foreignCrontabLines()); err == nil {
+				err = errCron
+			}
+		}
+	case "list":
+		jf, errLoad := loadJobFile(cfgPath, "")
+		if errLoad != nil {
+			fmt.Printf("Error loading jobs from %s : %v\r\n", cfgPath, errLoad)
+			return 1
+		}
+		jobs, errJobs := getScheduledJobs(jf)
+		if errJobs != nil {
+			fmt.Printf("%v\r\n", errJobs)
+			return 1
+		}
+		fmt.Printf("\r\n%-20s %-20s %s\r\n", "Job", "Schedule", "Next run")
+		for _, sj := range jobs {
+			fmt.Printf("%-20s %-20s %s\r\n", sj.job.Name, sj.job.Schedule, sj.schedule.Next(time.Now()).Format(time.UnixDate))
+		}
+	default:
+		fmt.Printf("Unknown schedule action '%s'. Expecting install, remove or list\r\n", action)
+		return 1
+	}
+	if err != nil {
+		fmt.Printf("%v\r\n", err)
+		return 1
+	}
+	return 0
+}
+
+// last run of each job. Kept so that runs missed while the daemon (or the machine) was down are caught up.
+func daemonStatePath() (string, error) {
+	dir, err := ztbackup.ZtFolder()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, daemonStateFile), nil
+}
+
+func loadDaemonState() map[string]time.Time {
+	state := make(map[string]time.Time)
+	fPath, err := daemonStatePath()
+	if err != nil {
+		return state
+	}
+	if data, err := os.ReadFile(fPath); err == nil {
+		json.Unmarshal(data, &state)
+	}
+	return state
+}
+
+func saveDaemonState(state map[string]time.Time) {
+	fPath, err := daemonStatePath()
+	if err != nil {
+		return
+	}
+	data, _ := json.MarshalIndent(state, "", "  ")
+	os.WriteFile(fPath, data, 0644)
+}
+
+// gozt daemon [--config file]
+// Runs the scheduled jobs, one at a time. A job that is still running (or waiting to run) when it is due again is not queued twice.
+func cmdDaemon(ctx context.Context, bkp *ztbackup.Backup, opts map[string]string) int {
+	cfgPath, err := getJobFilePath(opts)
+	if err != nil {
+		fmt.Printf("Unable to find the jobs : %v\r\n", err)
+		return 1
+	}
+	jf, err := loadJobFile(ztbackup.ExpandHome(cfgPath), "")
+	if err != nil {
+		fmt.Printf("Error loading jobs from %s : %v\r\n", cfgPath, err)
+		return 1
+	}
+	jobs, err := getScheduledJobs(jf)
+	if err != nil {
+		fmt.Printf("%v\r\n", err)
+		return 1
+	}
+	if len(jobs) == 0 {
+		fmt.Printf("No job in %s has a schedule\r\n", cfgPath)
+		return 1
+	}
+
+	var mu sync.Mutex
+	state := loadDaemonState()
+	queued := make(map[string]bool)
+	queue := make(chan *ztJob, len(jobs))
+	logs := make(jobLogs) //open while the daemon runs
+	defer logs.close()
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for job := range queue {
+			if ctx.Err() != nil {
+				continue //stopping. The job is due again at the next start.
+			}
+			res := job.Run(ctx, bkp, logs)
+			printJobSummary(bkp, []jobResult{res})
+			mu.Lock()
+			queued[job.Name] = false
+			if ctx.Err() == nil {
+				state[job.Name] = time.Now()
+				saveDaemonState(state)
+			}
+			mu.Unlock()
+		}
+	}()
+
+	//next run of each job. Missed runs (since the last run) are due right away.
+	next := make([]time.Time, len(jobs))
+	now := time.Now()
+	for i, sj := range jobs {
+		last, ok := state[sj.job.Name]
+		if !ok {
+			last = now
+		}
+		next[i] = sj.schedule.Next(last).Add(jitterDelay(sj.jitter))
+		bkp.LogPrintf("Job %-20s next run at %s\r\n", sj.job.Name, next[i].Format(time.UnixDate))
+	}
+
+	for {
+		now = time.Now()
+		for i, sj := range jobs {
+			if next[i].IsZero() || now.Before(next[i]) {
+				continue
+			}
+			mu.Lock()
+			if queued[sj.job.Name] {
+				bkp.LogPrintf("Job '%s' is still running. Skipping the run due at %s\r\n", sj.job.Name, next[i].Format(time.UnixDate))
+			} else {
+				queued[sj.job.Name] = true
+				queue <- sj.job
+			}
+			mu.Unlock()
+			next[i] = sj.schedule.Next(now).Add(jitterDelay(sj.jitter))
+		}
+		select {
+		case <-ctx.Done():
+			bkp.LogPrintf("\r\nStopping (%v). Waiting for the running job (if any) to end.\r\n", context.Cause(ctx))
+			close(queue)
+			<-stopped
+			return exitSuccess
+		case <-time.After(daemonTick):
+		}
+	}
+}
@@ -0,0 +1,257 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gkdada/gozt/ztbackup"
+)
+
+// Zero-touch mode. gozt watch keeps an eye on /proc/self/mountinfo and, when a volume is mounted that has
+// a .ztbackup job file at its root, runs the jobs in it. Relative paths in that file are relative to the
+// root of the volume. e.g. a USB drive with
+//
+//	recursive = true
+//	[[job]]
+//	source = "/home/myuser/Documents"
+//	destination = "Backups/Documents"
+//
+// is updated every time it is plugged in.
+//
+// Anybody can write a job file to a drive. So, the jobs are only run for the volumes listed (by the UUID of
+// their file system) in the user's own jobs.toml:
+//
+//	drives = ["2f1c9a7e-0b4d-4c51-9d0e-6a3b8f2e1d45"]
+//
+// and even then, they may not run commands (pre, post), pick the SSH key or the log folder, and their
+// destinations have to be on the volume itself.
+const mountInfoFile = "/proc/self/mountinfo"
+const uuidFolder = "/dev/disk/by-uuid"
+const driveJobFile = ".ztbackup"
+const driveLogFile = ".ztbackup.log"
+const defaultWatchInterval = 2 * time.Second
+
+// the mount points and their sources (devices). Mount points are the 5th field, with spaces etc. escaped in
+// octal (\040). The source is the second field after the " - " separator.
+func readMountPoints() (map[string]string, error) {
+	fl, err := os.Open(mountInfoFile)
+	if err != nil {
+		return nil, err
+	}
+	defer fl.Close()
+
+	mounts := make(map[string]string)
+	scans := bufio.NewScanner(fl)
+	for scans.Scan() {
+		fields := strings.Fields(scans.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		source := ""
+		for i := 5; i < len(fields)-2; i++ {
+			if fields[i] == "-" {
+				source = unescapeMountPath(fields[i+2])
+				break
+			}
+		}
+		mounts[unescapeMountPath(fields[4])] = source
+	}
+	return mounts, scans.Err()
+}
+
+func unescapeMountPath(szPath string) string {
+	if !strings.Contains(szPath, "\\") {
+		return szPath
+	}
+	var sb strings.Builder
+	for i := 0; i < len(szPath); i++ {
+		if szPath[i] == '\\' && i+3 < len(szPath) {
+			if ch, err := strconv.ParseUint(szPath[i+1:i+4], 8, 8); err == nil {
+				sb.WriteByte(byte(ch))
+				i += 3
+				continue
+			}
+		}
+		sb.WriteByte(szPath[i])
+	}
+	return sb.String()
+}
+
+// the UUID of the file system on device (e.g. /dev/sdb1). Empty if not known.
+func volumeId(device string) string {
+	devPath, err := filepath.EvalSymlinks(device)
+	if err != nil {
+		return ""
+	}
+	entries, err := os.ReadDir(uuidFolder)
+	if err != nil {
+		return ""
+	}
+	for _, entry := range entries {
+		if target, err := filepath.EvalSymlinks(filepath.Join(uuidFolder, entry.Name())); err == nil && target == devPath {
+			return entry.Name()
+		}
+	}
+	return ""
+}
+
+// whether szPath (which may not exist yet) is on the volume, symbolic links included
+func isUnderMount(szPath string, mountPoint string) bool {
+	root, err := filepath.EvalSymlinks(mountPoint)
+	if err != nil {
+		return false
+	}
+	szPath = filepath.Clean(szPath)
+	rest := ""
+	for {
+		//the part that exists is resolved. The rest is created under it.
+		resolved, err := filepath.EvalSymlinks(szPath)
+		if err == nil {
+			rel, err := filepath.Rel(root, filepath.Join(resolved, rest))
+			return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(os.PathSeparator))
+		}
+		parent := filepath.Dir(szPath)
+		if !errors.Is(err, os.ErrNotExist) || parent == szPath {
+			return false
+		}
+		rest = filepath.Join(filepath.Base(szPath), rest)
+		szPath = parent
+	}
+}
+
+// the job file came with the drive. See above.
+func checkDriveJobs(jf *ztJobFile, mountPoint string) error {
+	for _, job := range jf.Jobs {
+		for name, value := range map[string]string{"pre": job.Pre, "post": job.Post, "ssh_key": job.SshKey, "log_dir": job.LogDir} {
+			if len(value) != 0 {
+				return fmt.Errorf("job '%s': %s is not allowed in the job file of a volume", job.Name, name)
+			}
+		}
+		if strings.ContainsRune(job.Name, os.PathSeparator) {
+			return fmt.Errorf("job '%s': invalid name", job.Name)
+		}
+		if strings.Contains(job.Destination, "://") || !isUnderMount(job.Destination, mountPoint) {
+			return fmt.Errorf("job '%s': the destination %s is not on the volume", job.Name, job.Destination)
+		}
+	}
+	return nil
+}
+
+// the volumes whose jobs may be run, from the user's job file (if any)
+func loadAllowedDrives(cfgPath string) (map[string]bool, error) {
+	allowed := make(map[string]bool)
+	jf, err := loadJobFile(ztbackup.ExpandHome(cfgPath), "")
+	if errors.Is(err, os.ErrNotExist) {
+		return allowed, nil
+	} else if err != nil {
+		return nil, err
+	}
+	for _, id := range jf.Drives {
+		allowed[strings.ToLower(id)] = true
+	}
+	return allowed, nil
+}
+
+// runs the jobs in the volume's job file if the volume is allowed. The summary is appended to .ztbackup.log
+// on the volume.
+func runDriveJobs(ctx context.Context, bkp *ztbackup.Backup, mountPoint string, device string, allowed map[string]bool) {
+
+	fPath := fmt.Sprintf("%s%c%s", mountPoint, os.PathSeparator, driveJobFile)
+	fst, err := os.Lstat(fPath)
+	if err != nil || !fst.Mode().IsRegular() {
+		return
+	}
+
+	id := volumeId(device)
+	if len(id) == 0 || !allowed[strings.ToLower(id)] {
+		bkp.LogPrintf("\r\nVolume mounted at %s (%s, UUID '%s') has a job file, but is not one of the drives allowed in jobs.toml. Not running it.\r\n",
+			mountPoint, device, id)
+		return
+	}
+
+	bkp.LogPrintf("\r\nVolume mounted at %s has a job file. Starting backup at %s\r\n", mountPoint, time.Now().Format(time.UnixDate))
+
+	jf, err := loadJobFile(fPath, mountPoint)
+	if err == nil {
+		err = checkDriveJobs(jf, mountPoint)
+	}
+	if err != nil {
+		bkp.LogPrintf("Error loading jobs from %s : %v\r\n", fPath, err)
+		return
+	}
+	var jobs []*ztJob
+	for i := range jf.Jobs {
+		jobs = append(jobs, &jf.Jobs[i])
+	}
+	results := runJobs(ctx, bkp, jobs)
+	summary := printJobSummary(bkp, results)
+
+	lPath := fmt.Sprintf("%s%c%s", mountPoint, os.PathSeparator, driveLogFile)
+	dl, err := os.OpenFile(lPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY|syscall.O_NOFOLLOW, 0644)
+	if err != nil {
+		bkp.LogPrintf("Error writing results to %s : %v\r\n", lPath, err)
+		return
+	}
+	fmt.Fprintf(dl, "\r\nBackup on %s%s", time.Now().Format(time.UnixDate), summary)
+	dl.Close()
+}
+
+// gozt watch [--interval seconds] [--config file]
+func cmdWatch(ctx context.Context, bkp *ztbackup.Backup, opts map[string]string) int {
+	interval := defaultWatchInterval
+	if szInterval, ok := opts["interval"]; ok {
+		secs, err := strconv.Atoi(szInterval)
+		if err != nil || secs <= 0 {
+			fmt.Printf("Invalid interval '%s'\r\n", szInterval)
+			return 1
+		}
+		interval = time.Duration(secs) * time.Second
+	}
+
+	cfgPath, err := getJobFilePath(opts)
+	if err != nil {
+		fmt.Printf("Unable to find the jobs : %v\r\n", err)
+		return 1
+	}
+	allowed, err := loadAllowedDrives(cfgPath)
+	if err != nil {
+		fmt.Printf("Error loading %s : %v\r\n", cfgPath, err)
+		return 1
+	}
+
+	known, err := readMountPoints()
+	if err != nil {
+		fmt.Printf("Unable to read %s : %v\r\n", mountInfoFile, err)
+		return 1
+	}
+	bkp.LogPrintf("Watching for volumes with a %s job file (%d volumes already mounted)\r\n", driveJobFile, len(known))
+
+	for {
+		select {
+		case <-ctx.Done():
+			return exitSuccess //any job running was cancelled (and its summary written)
+		case <-time.After(interval):
+		}
+		current, err := readMountPoints()
+		if err != nil {
+			continue
+		}
+		for mountPoint, device := range current {
+			if _, ok := known[mountPoint]; !ok {
+				runDriveJobs(ctx, bkp, mountPoint, device, allowed)
+			}
+		}
+		known = current
+	}
+}
@@ -0,0 +1,71 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUnescapeMountPath(t *testing.T) {
+	if got := unescapeMountPath(`/media/my\040drive`); got != "/media/my drive" {
+		t.Errorf("unexpected %q", got)
+	}
+	if got := unescapeMountPath(`/mnt/usb`); got != "/mnt/usb" {
+		t.Errorf("unexpected %q", got)
+	}
+}
+
+func TestReadMountPoints(t *testing.T) {
+	mounts, err := readMountPoints()
+	if err != nil {
+		t.Skip("mountinfo not available: ", err)
+	}
+	if _, ok := mounts["/"]; !ok {
+		t.Errorf("root file system not found in %s", mountInfoFile)
+	}
+}
+
+func TestCheckDriveJobs(t *testing.T) {
+	mount, home := t.TempDir(), t.TempDir()
+	if err := os.Symlink(home, filepath.Join(mount, "home")); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		job   string
+		valid bool
+	}{
+		{`source = "/etc"` + "\n" + `destination = "Backups/etc"`, true},
+		{`source = "Documents"` + "\n" + `destination = "."`, true},
+		{`source = "/etc"` + "\n" + `destination = "/tmp"`, false},
+		{`source = "/etc"` + "\n" + `destination = "../outside"`, false},
+		{`source = "/etc"` + "\n" + `destination = "home/new"`, false}, //a link out of the volume
+		{`source = "/etc"` + "\n" + `destination = "sftp://me@nas/etc"`, false},
+		{`source = "/etc"` + "\n" + `destination = "etc"` + "\n" + `pre = "touch /tmp/x"`, false},
+		{`source = "/etc"` + "\n" + `destination = "etc"` + "\n" + `post = "touch /tmp/x"`, false},
+		{`source = "/etc"` + "\n" + `destination = "etc"` + "\n" + `ssh_key = "~/.ssh/id_ed25519"`, false},
+		{`source = "/etc"` + "\n" + `destination = "etc"` + "\n" + `log_dir = "~/.config"`, false},
+	}
+	for _, test := range tests {
+		fPath := filepath.Join(mount, driveJobFile)
+		if err := os.WriteFile(fPath, []byte("[[job]]\n"+test.job+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		jf, err := loadJobFile(fPath, mount)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = checkDriveJobs(jf, mount); (err == nil) != test.valid {
+			t.Errorf("%q: %v", test.job, err)
+		}
+	}
+
+	//defaults are checked as well
+	fPath := filepath.Join(mount, driveJobFile)
+	os.WriteFile(fPath, []byte("post = \"touch /tmp/x\"\n[[job]]\nsource = \"/etc\"\ndestination = \"etc\"\n"), 0o644)
+	if jf, err := loadJobFile(fPath, mount); err != nil || checkDriveJobs(jf, mount) == nil {
+		t.Errorf("a default post command was allowed")
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gkdada/gozt/ztbackup"
+)
+
+// zero-touch mode depends on /proc/self/mountinfo
+func cmdWatch(ctx context.Context, bkp *ztbackup.Backup, opts map[string]string) int {
+	fmt.Printf("gozt watch is only supported on Linux\r\n")
+	return 1
+}
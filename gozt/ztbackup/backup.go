@@ -0,0 +1,1079 @@
+package ztbackup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/text/message"
+)
+
+type BackupOption uint16
+
+const (
+	OptAsk BackupOption = iota
+	OptLeave
+	OptDelete
+)
+
+type Statistics struct {
+	NumFolders int64 `json:"folders"`
+
+	NumFilesSkipped  int64 `json:"files_skipped"`
+	SizeFilesSkipped int64 `json:"size_skipped"`
+
+	NumFilesCopied  int64 `json:"files_copied"`
+	SizeFilesCopied int64 `json:"size_copied"`
+
+	NumFilesDeleted  int64 `json:"files_deleted"`
+	SizeFilesDeleted int64 `json:"size_deleted"`
+
+	NumFilesRestored  int64 `json:"files_restored"`
+	SizeFilesRestored int64 `json:"size_restored"`
+
+	NumErrors  int64 `json:"errors"`  //files or folders that could not be copied, restored, deleted or read
+	NumRetries int64 `json:"retries"` //operations retried after a lost connection was re-established
+
+	DurationSeconds float64 `json:"duration_seconds"`
+	BytesPerSecond  float64 `json:"bytes_per_second"` //copied and restored
+}
+
+// what to back up and how. The command line flags (-a, -r etc.) and the settings of a job map to these.
+type Options struct {
+	FileOption     BackupOption //what to do with a backed up file that is missing in the source
+	FolderOption   BackupOption //same for a folder
+	RecursiveFlag  bool
+	VersionFlag    bool                 //keep replaced/deleted files in the destination's .ztversions folder
+	Excludes       []string             //excluded in every folder, in addition to .ztexclude
+	BandwidthLimit int64                //bytes per second. 0 for no limit
+	WatchFlag      bool                 //after the backup, keep watching the source for changes (sync --watch)
+	PrescanFlag    bool                 //count what needs to be copied first, to show the overall progress (--prescan)
+	ReviewFlag     bool                 //collect the questions and ask them all at the end of the run (--review)
+	BreakLock      bool                 //take the lock on the destination even if another run holds it (--break-lock)
+	SpaceCheck     string               //what to do when the destination is full: warn (default), abort or off (--space-check)
+	Quota          int64                //bytes each destination folder may use (--quota). 0 for no quota
+	QuotaPercent   float64              //or percent of the size of its file system
+	Quotas         map[string]DestQuota //per destination (as given to Run), instead of Quota and QuotaPercent
+	RescanFlag     bool                 //list every destination folder instead of using the listings saved by the last run (--rescan)
+	ReflinkFlag    bool                 //clone local files (btrfs, XFS) instead of copying them where possible (--reflink)
+}
+
+// A Backup runs a backup (Run) or a restore (Restore) and keeps its statistics. The zero value (with the
+// Options set) is ready to use. Nothing is printed unless Console is set.
+type Backup struct {
+	Options
+	Prompter   Prompter    //answers the questions. Every question takes its default answer if nil.
+	Console    io.Writer   //where the human readable output (progress, questions etc.) goes. Discarded if nil.
+	OnEvent    func(Event) //called for every action (copied, deleted, error etc.) on any of the destinations
+	Display    Display     //shows the progress of the copies instead of Console. e.g. a full-screen UI
+	Statistics Statistics
+	Log        ZtLog
+
+	folderSkipCount  int
+	statPrinter      *message.Printer
+	srcBack, dstBack *BackupFolder
+	catalog          *ztCatalog
+	state            *ztState //listings of the destination kept between runs. nil if not kept.
+	srcLabel         string
+	dstLabel         string
+	auditLog         *ZtLog //where the actions are logged. Log if nil.
+	started          time.Time
+	progress         *ztProgress             //nil without --prescan
+	isTTY            bool                    //the console is a terminal. Progress is shown in place.
+	review           *ztReview               //the pending questions with --review. Shared by all destinations.
+	cancelRun        context.CancelCauseFunc //see Cancel. Shared by all destinations.
+	space            *ztSpace                //free space and quota of the destination. nil if not checked.
+	mirrors          []*Backup               //additional destinations. They share the traversal (and the reading) of the source.
+	unavailable      []Result                //destinations that could not be opened, for the summary
+	copyBuffer       []byte
+}
+
+// we try 10Meg buffer size
+const COPY_BUFFERSIZE = 512000
+
+func (bkp *Backup) LogPrintf(format string, a ...any) {
+
+	bkp.Log.SetConsole(bkp.console())
+	bkp.Log.Printf(format, a...)
+}
+
+// backs up Src to every one of Dsts (folders or URLs) in a single pass over the source. With WatchFlag, keeps
+// watching the source afterwards until ctx is cancelled.
+func (bkp *Backup) Run(ctx context.Context, Src string, Dsts []string, fo FolderOptions) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	bkp.cancelRun = cancel
+	fo.Context, fo.Log = ctx, &bkp.Log
+
+	bkp.logStart(Src, Dsts)
+
+	bkp.srcLabel, bkp.dstLabel = Src, Dsts[0]
+	srcBack, err := InitializeWithOptions(Src, nil, fo)
+	if err != nil {
+		bkp.LogPrintf("\r\nUnable to open the source folder. %v\r\n", err)
+		for _, Dst := range Dsts[1:] {
+			bkp.unavailable = append(bkp.unavailable, Result{Source: FolderLabel(Src), Destination: FolderLabel(Dst), Error: err.Error()})
+		}
+		return err
+	}
+	defer srcBack.Close()
+	return bkp.runFrom(ctx, srcBack, Src, Dsts, fo)
+}
+
+// backs up an already open source (e.g. from InitializeFromFS), labelled Src in the logs and the results, to
+// every one of Dsts. The source is not closed.
+func (bkp *Backup) RunFrom(ctx context.Context, srcBack BackupFolder, Src string, Dsts []string, fo FolderOptions) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	bkp.cancelRun = cancel
+	fo.Context, fo.Log = ctx, &bkp.Log
+
+	bkp.logStart(Src, Dsts)
+	bkp.srcLabel, bkp.dstLabel = Src, Dsts[0]
+	return bkp.runFrom(ctx, srcBack, Src, Dsts, fo)
+}
+
+func (bkp *Backup) logStart(Src string, Dsts []string) {
+	bkp.LogPrintf("Initiating zero-touch backup at %s\r\n", time.Now().Format(time.UnixDate))
+	bkp.LogPrintf("Source Folder: %s\r\n", Src)
+	for _, Dst := range Dsts {
+		bkp.LogPrintf("Destination Folder: %s\r\n", Dst)
+	}
+}
+
+// the destinations are opened (and locked) here
+func (bkp *Backup) runFrom(ctx context.Context, srcBack BackupFolder, Src string, Dsts []string, fo FolderOptions) error {
+	//a destination that can't be opened is skipped (and reported) as long as another one can
+	var dstBacks []BackupFolder
+	var dstLabels []string
+	var dstErrs []error
+	for _, Dst := range Dsts {
+		dstBack, err := InitializeWithOptions(Dst, srcBack, fo)
+		if err != nil {
+			bkp.LogPrintf("\r\nUnable to open the destination folder. %v\r\n", err)
+			bkp.unavailable = append(bkp.unavailable, Result{Source: FolderLabel(Src), Destination: FolderLabel(Dst), Error: err.Error()})
+			dstErrs = append(dstErrs, err)
+			continue
+		}
+		defer dstBack.Close()
+		dstBacks = append(dstBacks, dstBack)
+		dstLabels = append(dstLabels, Dst)
+	}
+	if len(dstBacks) == 0 {
+		bkp.unavailable = bkp.unavailable[1:] //the first destination is reported with the error returned
+		return dstErrs[0]
+	}
+	if len(dstErrs) != 0 {
+		bkp.LogPrintf("Skipping the destinations that can't be opened.\r\n")
+	}
+
+	for i, Dst := range dstLabels {
+		lock, err := bkp.takeLock(dstBacks[i], Dst, bkp.cancelRun)
+		if err != nil {
+			bkp.LogPrintf("\r\n%v\r\n", err)
+			return err
+		}
+		defer lock.Release()
+	}
+
+	bkp.srcLabel = Src
+	bkp.dstLabel = dstLabels[0]
+	bkp.OpenCatalog(dstBacks[0], dstLabels[0])
+	for i := 1; i < len(dstLabels); i++ {
+		bkp.AddDestination(&dstBacks[i], dstLabels[i])
+	}
+
+	err := bkp.StartBackup(ctx, &srcBack, &dstBacks[0])
+	if err == nil && bkp.WatchFlag {
+		err = bkp.WatchSync(ctx)
+		if err != nil {
+			bkp.LogPrintf("\r\n%v\r\n", err)
+		}
+	}
+	return err
+}
+
+// adds another destination to be backed up in the same run. Statistics are kept per destination.
+func (bkp *Backup) AddDestination(dst *BackupFolder, szDst string) {
+	mirror := &Backup{dstBack: dst, dstLabel: szDst, auditLog: &bkp.Log}
+	mirror.OpenCatalog(*dst, szDst)
+	bkp.mirrors = append(bkp.mirrors, mirror)
+}
+
+// this destination followed by the additional ones
+func (bkp *Backup) destinations() []*Backup {
+	return append([]*Backup{bkp}, bkp.mirrors...)
+}
+
+func (bkp *Backup) StartBackup(ctx context.Context, src *BackupFolder, dst *BackupFolder) error {
+
+	bkp.srcBack = src
+	bkp.dstBack = dst
+
+	bkp.copyBuffer = make([]byte, COPY_BUFFERSIZE)
+
+	bkp.statPrinter = message.NewPrinter(message.MatchLanguage("en")) //for now, we default to English (since all our messages are in English anyway)
+	bkp.isTTY = isTerminal(bkp.console())
+	if bkp.ReviewFlag {
+		bkp.review = &ztReview{}
+	}
+
+	for _, mirror := range bkp.mirrors {
+		mirror.Options = bkp.Options
+		mirror.srcLabel = bkp.srcLabel
+		mirror.isTTY = bkp.isTTY
+		mirror.Prompter = bkp.Prompter
+		mirror.Console = bkp.Console
+		mirror.OnEvent = bkp.OnEvent
+		mirror.Display = bkp.Display
+		mirror.review = bkp.review
+		mirror.cancelRun = bkp.cancelRun
+		mirror.srcBack = src
+		mirror.statPrinter = bkp.statPrinter
+		mirror.copyBuffer = bkp.copyBuffer //one copy at a time
+	}
+	for _, dest := range bkp.destinations() {
+		dest.openState()
+	}
+
+	bkp.started = time.Now()
+	bkp.LogPrintf("\rStarted at %s\r\n", bkp.started.Format(time.UnixDate))
+	for _, dest := range bkp.destinations() {
+		dest.emit(Event{Event: EvRunStart, Source: bkp.srcLabel})
+	}
+	defer bkp.printStatistics()
+	//"Ended at" now moved to printStatistics
+	//defer fmt.Println("\rEnded at ", time.Now().Format(time.UnixDate))
+
+	bkp.openSpace()
+	if bkp.PrescanFlag {
+		bkp.startProgress()
+		if err := bkp.checkProjectedSpace(); err != nil {
+			return err
+		}
+	}
+
+	err := bkp.recurseBackup(ctx, "")
+
+	if bkp.review != nil {
+		if ctx.Err() == nil {
+			bkp.reviewPending(ctx)
+		}
+		for _, dest := range bkp.destinations() {
+			dest.review = nil //sync --watch asks as usual
+		}
+	}
+
+	for _, dest := range bkp.destinations() {
+		if dest.catalog != nil {
+			if errCat := dest.catalog.Save(); errCat != nil {
+				dest.reportError("", "Error saving catalog", errCat)
+			}
+		}
+		if dest.state != nil && err == nil && ctx.Err() == nil { //only the listings of a complete run are kept
+			if errState := dest.state.Save(); errState != nil {
+				dest.reportError("", "Error saving the destination listings", errState)
+			}
+		}
+	}
+	return bkp.checkCancelled(ctx, err)
+}
+
+// true if the run was cancelled (see Cancel). Waits while the Display has the run paused.
+func (bkp *Backup) stopped(ctx context.Context) bool {
+	if bkp.Display != nil {
+		bkp.Display.Transferred(ctx, 0)
+	}
+	return ctx.Err() != nil
+}
+
+// stops the run after the file being copied (which is removed). cause is returned by Run (or Restore)
+// and should wrap ErrCancelled. Does nothing if no run was started.
+func (bkp *Backup) Cancel(cause error) {
+	if bkp.cancelRun != nil {
+		bkp.cancelRun(cause)
+	}
+}
+
+// logs that the run was cancelled (if it was) and returns why. Otherwise returns err.
+func (bkp *Backup) checkCancelled(ctx context.Context, err error) error {
+	if ctx.Err() == nil {
+		return err
+	}
+	cause := context.Cause(ctx)
+	bkp.LogPrintf("\r\nRun %v. The statistics are for the part done.\r\n", cause)
+	return cause
+}
+
+// files and folders gozt keeps at the root of the destination for its own use
+func isDestinationMeta(name string) bool {
+	return name == versionFolder || name == catalogIdFile || name == lockFileName || name == stateTokenFile ||
+		strings.HasPrefix(name, lockFileName+".") //a lock being broken or released
+}
+
+const progress_wheel = "|/-\\"
+
+func (bkp *Backup) recurseBackup(ctx context.Context, folderPath string) error {
+	return bkp.backupFolder(ctx, folderPath, true)
+}
+
+// backs up a single folder. If bDescend is false, the sub-folders in source are not processed
+// (but the ones missing in source are still checked if RecursiveFlag is set)
+func (bkp *Backup) backupFolder(ctx context.Context, folderPath string, bDescend bool) error {
+
+	//read the .ztbackup (if any). Applies only to THIS folder,
+	var zte ztExclude
+
+	zte.LoadFile(*bkp.srcBack, folderPath)
+	zte.exGlobalList = bkp.Excludes
+
+	if len(folderPath) != 0 {
+		bkp.Printf("\rProcessing folder %s\r\n", folderPath)
+	}
+	fmts, err := ReadDir(*bkp.srcBack, folderPath)
+
+	if err != nil {
+		bkp.reportSourceError(folderPath, "Error reading folder", err)
+		return err
+	}
+
+	//destinations that could not be prepared are left out of this folder.
+	var dests []*Backup
+	var joins []*ztJoin //of the source listing with each destination's
+	srcInfo, _ := getFileInfo(*bkp.srcBack, folderPath, "")
+	for _, dest := range bkp.destinations() {
+		dest.Statistics.NumFolders++
+		dest.folderSkipCount = 0
+		err = dest.ensurePath(*dest.dstBack, folderPath, srcInfo.Mode())
+		if err != nil {
+			dest.reportError(folderPath, "Error creating path for", err)
+			continue
+		}
+		dest.emit(Event{Event: EvFolder, Path: folderPath})
+		dests = append(dests, dest)
+		fmtd, errDst := ReadDir(*dest.dstBack, folderPath)
+		joins = append(joins, joinListings(fmts, *dest.dstBack, folderPath, fmtd, errDst))
+	}
+	if len(dests) == 0 {
+		return err
+	}
+
+	//1. for each file in source, backup as required.
+	for i, ctr := range fmts {
+		//log.Printf("ctr: %s \t\t%s", ModeString(ctr), ctr.Name())
+		if len(folderPath) == 0 && isDestinationMeta(ctr.Name()) {
+			continue //source may itself be a destination of another backup. Do not copy its identity, lock, versions etc.
+		}
+		if bkp.stopped(ctx) {
+			return context.Cause(ctx)
+		}
+		if ctr.Mode().IsRegular() {
+			bkp.processSourceFile(ctx, ctr, i, folderPath, zte, dests, joins)
+		}
+	}
+
+	//2. for each file in destination, check source
+	nChecked := 0
+	for _, dest := range dests {
+		err = dest.checkDestination(ctx, folderPath, fmts, zte)
+		if err == nil {
+			nChecked++
+		}
+	}
+	if nChecked == 0 {
+		return err
+	}
+
+	//3. for each folder in source, recurse
+	for _, ctr := range fmts {
+		//log.Printf("ctr: %s \t\t%s", ModeString(ctr), ctr.Name())
+		if len(folderPath) == 0 && isDestinationMeta(ctr.Name()) {
+			continue
+		}
+		if bkp.stopped(ctx) {
+			return context.Cause(ctx)
+		}
+		if ctr.IsDir() && bkp.RecursiveFlag && bDescend {
+			/*err :=*/
+			if !zte.IsExcluded(ctr.Name()) {
+				bkp.recurseBackup(ctx, bkp.prepareName(folderPath, ctr.Name()))
+			} else {
+				for _, dest := range bkp.destinations() {
+					dest.Statistics.NumFolders++
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// checks the files and folders of this destination against the source (listed as fmts). The destination is
+// listed again, with the files just copied.
+func (bkp *Backup) checkDestination(ctx context.Context, folderPath string, fmts []fs.FileInfo, zte ztExclude) error {
+	fmtd, err := ReadDir(*bkp.dstBack, folderPath)
+
+	if err != nil {
+		bkp.reportError(folderPath, "Error reading destination folder", err)
+		return err
+	}
+	if bkp.catalog != nil {
+		bkp.catalog.folderListed(folderPath)
+	}
+	srcJoin := joinListings(fmtd, *bkp.srcBack, folderPath, fmts, nil)
+
+	for i, ctr := range fmtd {
+		//log.Printf("ctr: %s \t\t%s", ModeString(ctr), ctr.Name())
+		if len(folderPath) == 0 && isDestinationMeta(ctr.Name()) {
+			continue //never part of the source.
+		}
+		if bkp.stopped(ctx) {
+			return context.Cause(ctx)
+		}
+		if ctr.IsDir() && bkp.RecursiveFlag {
+			_, err := srcJoin.find(i, ctr.Name())
+			if errors.Is(err, fs.ErrNotExist) {
+				status := bkp.fileMissingQuestion(ctx, folderPath, ctr)
+				subPath := bkp.prepareName(folderPath, ctr.Name())
+				switch status {
+				case copyDeleteDestination:
+					bkp.recurseDelete(*bkp.dstBack, subPath)
+				case copyBackward:
+					bkp.recurseRestore(ctx, subPath, ctr)
+				case copyLeave:
+					bkp.emit(Event{Event: EvSkipped, Path: subPath, Reason: "source folder missing"})
+				}
+			}
+
+		} else if ctr.Mode().IsRegular() {
+			bkp.processRegularFile(ctx, ctr, folderPath, zte, srcJoin, i)
+		}
+	}
+	return nil
+}
+
+func (bkp *Backup) recurseRestore(ctx context.Context, folderPath string, srcInfo fs.FileInfo) {
+	//since the folder doesn't exist, we just restore everything full speed
+	err := bkp.ensurePath(*bkp.srcBack, folderPath, srcInfo.Mode())
+	if err != nil {
+		bkp.reportError(folderPath, "Error creating path for", err)
+		return
+	}
+	fmtd, err := ReadDir(*bkp.dstBack, folderPath)
+
+	if err != nil {
+		bkp.reportError(folderPath, "Error reading destination folder", err)
+		return
+	}
+	//for each file
+	for _, ctr := range fmtd {
+		if bkp.stopped(ctx) {
+			return
+		}
+		if ctr.Mode().IsRegular() {
+			bkp.copyFile(ctx, folderPath, ctr, false, "source folder missing")
+		}
+	}
+	//for each folder
+	for _, ctr := range fmtd {
+		//log.Printf("ctr: %s \t\t%s", ModeString(ctr), ctr.Name())
+		if ctr.IsDir() {
+			bkp.recurseRestore(ctx, bkp.prepareName(folderPath, ctr.Name()), ctr)
+		}
+	}
+
+}
+
+func (bkp *Backup) recurseDelete(bkps BackupFolder, folderName string) {
+	if bkp.catalog != nil {
+		bkp.catalog.folderRemoved(folderName)
+	}
+	nFiles, size := bkp.countFolder(bkps, folderName)
+	var err error
+	if bkp.VersionFlag {
+		err = bkp.archiveFolder(bkps, folderName)
+	} else {
+		err = bkps.RemoveAll(folderName)
+	}
+	if err != nil {
+		bkp.reportError(folderName, "Error deleting folder", err)
+		return
+	}
+	if !bkp.VersionFlag {
+		bkp.spaceFreed(size)
+	}
+	bkp.Statistics.NumFilesDeleted += nFiles
+	bkp.Statistics.SizeFilesDeleted += size
+	bkp.emit(Event{Event: EvDeleted, Path: folderName, Reason: "source folder missing"})
+}
+
+// the number of files in the folder (and its sub-folders) and their total size
+func (bkp *Backup) countFolder(bkps BackupFolder, folderPath string) (int64, int64) {
+	var nFiles, size int64
+	fmtd, err := ReadDir(bkps, folderPath)
+	if err != nil {
+		return 0, 0
+	}
+	for _, ctr := range fmtd {
+		if ctr.IsDir() {
+			n, sz := bkp.countFolder(bkps, bkp.prepareName(folderPath, ctr.Name()))
+			nFiles += n
+			size += sz
+		} else if ctr.Mode().IsRegular() {
+			nFiles++
+			size += ctr.Size()
+		}
+	}
+	return nFiles, size
+}
+
+func (bkp *Backup) prepareName(path string, name string) string {
+	if len(path) == 0 {
+		return name
+	}
+	return fmt.Sprintf("%s%c%s", path, os.PathSeparator, name)
+}
+
+type copyType uint16
+
+const (
+	copyForward           copyType = iota //source -> destination
+	copyBackward                          //destination -> source
+	copyLeave                             //leave the destination file /source file alone
+	copyDeleteDestination                 //delete the destination
+	copyDeferred                          //decided at the end of the run (--review)
+)
+
+// decides what to do with a source file (entry i of dstJoin) for this destination, and why. Returns the
+// destination file's info if it exists.
+func (bkp *Backup) forwardStatus(ctx context.Context, fStart fs.FileInfo, path string, zte ztExclude, dstJoin *ztJoin, i int) (copyType, fs.FileInfo, string) {
+	if zte.IsExcluded(fStart.Name()) { //skipped due to .ztexclude. Only applies to forward.
+		return copyLeave, nil, "excluded"
+	}
+	//1. Does the file exist in destination?
+	fDst, err := dstJoin.find(i, fStart.Name())
+	if errors.Is(err, fs.ErrNotExist) {
+		//fmt.Printf("File %s does not exist.\r\n", bkp.prepareName(path, fStart.Name()))
+		return copyForward, nil, "new file"
+	}
+	status, reason := bkp.copyCheck(ctx, path, fStart, fDst)
+	return status, fDst, reason
+}
+
+// backs up a source file (entry i of the folder) to every destination that needs it. The source file is read
+// only once. joins are those of dests.
+func (bkp *Backup) processSourceFile(ctx context.Context, fStart fs.FileInfo, i int, path string, zte ztExclude, dests []*Backup, joins []*ztJoin) {
+	var copyTo []*Backup
+	var reasons []string
+	for d, dest := range dests {
+		status, fDst, reason := dest.forwardStatus(ctx, fStart, path, zte, joins[d], i)
+		switch status {
+		case copyForward:
+			if !dest.checkSpace(path, fStart, fDst) {
+				continue
+			}
+			if dest.VersionFlag && fDst != nil {
+				if err := dest.archiveVersion(*dest.dstBack, path, fDst); err != nil {
+					dest.reportError(bkp.prepareName(path, fStart.Name()), "Error archiving old version of", err)
+					continue
+				}
+			}
+			copyTo = append(copyTo, dest)
+			reasons = append(reasons, reason)
+		case copyBackward:
+			dest.copyFile(ctx, path, fStart, false, reason)
+		case copyDeferred:
+		default:
+			dest.skipFile(path, fStart, true, reason)
+		}
+	}
+	if len(copyTo) != 0 {
+		bkp.copyFileToAll(ctx, path, fStart, copyTo, reasons)
+	}
+}
+
+// checks a file in the destination (entry i of srcJoin) against the source
+func (bkp *Backup) processRegularFile(ctx context.Context, fStart fs.FileInfo, path string, zte ztExclude, srcJoin *ztJoin, i int) error {
+	status := copyLeave
+	reason := ""
+	//In Reverse, we check for OS specific only. The rest can stay.
+	if zte.IsOsSpecific(fStart.Name()) {
+		status = copyDeleteDestination
+		reason = "os specific"
+	} else {
+		_, err := srcJoin.find(i, fStart.Name())
+		if errors.Is(err, fs.ErrNotExist) {
+			status = bkp.fileMissingQuestion(ctx, path, fStart)
+			reason = "source missing"
+		}
+	}
+	//if the file exists, no action during backward check
+	if status != copyDeleteDestination && bkp.catalog != nil {
+		bkp.catalog.addFile(bkp.prepareName(path, fStart.Name()), fStart.Size(), fStart.ModTime(), catalogCurrent)
+	}
+
+	switch status {
+	case copyBackward:
+		return bkp.copyFile(ctx, path, fStart, false, reason)
+	//case copyDeleteSource:
+	//	bkp.Statistics.NumFilesDeleted++
+	//	return (*bkp.srcBack).DeleteFile(path, fStart.Name())
+	case copyDeleteDestination:
+		return bkp.deleteFile(path, fStart, bkp.VersionFlag && !zte.IsOsSpecific(fStart.Name()), reason)
+	case copyDeferred:
+	default:
+		bkp.skipFile(path, fStart, false, reason)
+	}
+	return nil
+}
+
+// deletes (or, if bArchive, archives) a file in the destination
+func (bkp *Backup) deleteFile(path string, fStart fs.FileInfo, bArchive bool, reason string) error {
+	var err error
+	if bArchive {
+		err = bkp.archiveVersion(*bkp.dstBack, path, fStart)
+	} else {
+		err = (*bkp.dstBack).DeleteFile(path, fStart.Name())
+	}
+	if err != nil {
+		bkp.reportError(bkp.prepareName(path, fStart.Name()), "Error deleting", err)
+		return err
+	}
+	if bkp.catalog != nil {
+		bkp.catalog.removeFile(bkp.prepareName(path, fStart.Name()))
+	}
+	if !bArchive {
+		bkp.spaceFreed(fStart.Size())
+	}
+	bkp.Statistics.NumFilesDeleted++
+	bkp.Statistics.SizeFilesDeleted += fStart.Size()
+	bkp.emit(Event{Event: EvDeleted, Path: bkp.prepareName(path, fStart.Name()), Size: fStart.Size(), Reason: reason})
+	return nil
+}
+
+// reason is empty for a destination file that is simply present in the source. No event is reported for those.
+func (bkp *Backup) skipFile(path string, fStart fs.FileInfo, bForward bool, reason string) {
+	if bkp.isTTY {
+		bkp.Printf("\rSkipping...%c", progress_wheel[bkp.folderSkipCount%4])
+	}
+	bkp.folderSkipCount++
+	if bForward {
+		bkp.Statistics.NumFilesSkipped++
+		bkp.Statistics.SizeFilesSkipped += fStart.Size()
+	}
+	if len(reason) != 0 {
+		bkp.emit(Event{Event: EvSkipped, Path: bkp.prepareName(path, fStart.Name()), Size: fStart.Size(), Reason: reason, noAudit: bForward})
+	}
+}
+
+func (bkp *Backup) ensurePath(bkps BackupFolder, path string, perm fs.FileMode) error {
+	if len(path) == 0 { //we've already ensured this path exists before.
+		return nil
+	}
+	//fmt.Printf("Ensuring path %s\r\n", path)
+	return bkps.MkdirAll(prepareTargetName(bkps, path, ""), perm)
+}
+
+// returns what to do and why
+func (bkp *Backup) copyCheck(ctx context.Context, path string, fSrc fs.FileInfo, fDst fs.FileInfo) (copyType, string) {
+	//TODO: add exclusion (.ztexclude) check
+
+	//fmt.Printf("copyCheck for %s.\r\n", bkp.prepareName(path, fSrc.Name()))
+
+	switch compareFiles(fSrc, fDst) {
+	case copyForward:
+		if Diff := fSrc.ModTime().Sub(fDst.ModTime()); Diff > (time.Second * 6) {
+			return copyForward, "source newer by " + describeAge(Diff)
+		}
+		return copyForward, "size differs"
+	case copyBackward:
+		return bkp.fileRestoreQuestion(ctx, path, fSrc, fDst), "destination newer by " + describeAge(fDst.ModTime().Sub(fSrc.ModTime()))
+	}
+	return copyLeave, "unchanged"
+}
+
+// copyForward if the source is newer (or the size differs), copyBackward if the destination is newer.
+func compareFiles(fSrc fs.FileInfo, fDst fs.FileInfo) copyType {
+	if fSrc.ModTime().After(fDst.ModTime()) {
+		//fmt.Println("Destination time: ", fDst.ModTime())
+		//fmt.Println("     Source time: ", fSrc.ModTime())
+		Diff := fSrc.ModTime().Sub(fDst.ModTime())
+		//enough to ignore smb/ssh timestamp copy errors etc.
+		if Diff > (time.Second * 6) {
+			return copyForward
+		}
+	}
+
+	if fSrc.ModTime().Before(fDst.ModTime()) {
+		Diff := fDst.ModTime().Sub(fSrc.ModTime())
+		//enough to fix smb copy errors etc.
+		if Diff > (time.Second * 6) {
+			return copyBackward
+		}
+	}
+
+	//now, the mod time is same (or about the same). is the size different? Then we will go ahead and copy.
+	if fSrc.Size() != fDst.Size() {
+		return copyForward
+	}
+	return copyLeave
+}
+
+// This is used if a (backed up) file is missing in source.
+func (bkp *Backup) fileMissingQuestion(ctx context.Context, path string, fDst fs.FileInfo) copyType {
+
+	szItemType := "file"
+	if fDst.IsDir() {
+		szItemType = "folder"
+		if bkp.FolderOption == OptLeave {
+			return copyLeave
+		} else if bkp.FolderOption == OptDelete {
+			return copyDeleteDestination
+		}
+	} else {
+		if bkp.FileOption == OptLeave {
+			return copyLeave
+		} else if bkp.FileOption == OptDelete {
+			return copyDeleteDestination
+		}
+	}
+
+	if bkp.review != nil {
+		bkp.review.add(bkp, path, fDst, nil)
+		return copyDeferred
+	}
+
+	bkp.Printf("\rThe source for the backed up %s '%s' doesn't exist anymore.\r\n", szItemType, bkp.prepareName(path, fDst.Name()))
+	szQueryString := fmt.Sprintf("Do you want to (d)elete, (r)estore, or (l)eave the %s or [q]uit?", szItemType)
+	ans := bkp.askAbout(ctx, bkp.prepareName(path, fDst.Name()), szQueryString, "drl", 'l')
+	switch ans {
+	case 'd':
+		return copyDeleteDestination
+	case 'r':
+		return copyBackward
+	default:
+		return copyLeave
+	}
+}
+
+func (bkp *Backup) fileRestoreQuestion(ctx context.Context, path string, fSrc fs.FileInfo, fDst fs.FileInfo) copyType {
+
+	if bkp.FileOption == OptLeave {
+		return copyLeave
+	}
+	if bkp.review != nil {
+		bkp.review.add(bkp, path, fDst, fSrc)
+		return copyDeferred
+	}
+
+	bkp.statPrinter.Fprintln(bkp.console(), "\rThe destination for the backed up file '", bkp.prepareName(path, fSrc.Name()), "' is newer than the source.\r\n\r\n                size (bytes)            modified time\r\n")
+	bkp.statPrinter.Fprintf(bkp.console(), "source:      %26d %s\r\n", fSrc.Size(), fSrc.ModTime().String())
+	bkp.statPrinter.Fprintf(bkp.console(), "destination: %26d %s\r\n\r\n", fDst.Size(), fDst.ModTime().String())
+	//fmt.Printf("Do you want to (b)ackup, (r)estore, or (l)eave the file?")
+
+	ans := bkp.askAbout(ctx, bkp.prepareName(path, fSrc.Name()), "Do you want to (b)ackup, (r)estore, or (l)eave the file or [q]uit?", "brl", 'l')
+	switch ans {
+	case 'b':
+		return copyForward
+	case 'r':
+		return copyBackward
+	default:
+		return copyLeave
+	}
+}
+
+// asks the question (about the file in path) and reports it along with the answer
+func (bkp *Backup) askAbout(ctx context.Context, path string, Query string, Answers string, defaultAnswer rune) rune {
+	ans, defaulted := bkp.prompter().Ask(ctx, Query, Answers, defaultAnswer)
+	bkp.emit(Event{Event: EvPrompt, Path: path, Question: Query, Answer: string(ans), Defaulted: defaulted})
+	return ans
+}
+
+//if bForward is true, copy from source to destination
+//else copy from destination to source.
+
+//reason is reported along with the result.
+
+func (bkp *Backup) copyFile(ctx context.Context, path string, fi fs.FileInfo, bForward bool, reason string) error {
+
+	if bForward {
+		return bkp.copyFileToAll(ctx, path, fi, []*Backup{bkp}, []string{reason})[0]
+	}
+
+	bkFrom := *bkp.dstBack
+	bkTo := *bkp.srcBack
+	strAction := fmt.Sprintf("\rRestoring %s...", bkp.prepareName(path, fi.Name()))
+
+	started := time.Now()
+	err := bkp.transferFile(ctx, bkFrom, path, fi.Name(), bkTo, path, fi.Name(), fi.Size(), strAction)
+	if err == nil {
+		bkp.Statistics.NumFilesRestored++
+		bkp.Statistics.SizeFilesRestored += fi.Size()
+		//set mode and time
+		err = bkTo.SetParams(path, fi.Name(), fi.ModTime(), fi.Mode())
+	}
+	if err != nil && ctx.Err() != nil {
+		bkp.emit(Event{Event: EvSkipped, Path: bkp.prepareName(path, fi.Name()), Reason: "run cancelled"})
+		return err
+	}
+	if err != nil {
+		bkp.emit(Event{Event: EvError, Path: bkp.prepareName(path, fi.Name()), Reason: "restore failed", Error: err.Error()})
+		return err
+	}
+	bkp.emit(Event{Event: EvRestored, Path: bkp.prepareName(path, fi.Name()), Size: fi.Size(), DurationMs: msSince(started), Reason: reason})
+	return nil
+}
+
+// copies a source file to the destinations (reading it only once). Returns the error (if any) for each destination.
+// reasons holds why each destination needs the copy.
+func (bkp *Backup) copyFileToAll(ctx context.Context, path string, fi fs.FileInfo, dests []*Backup, reasons []string) []error {
+
+	started := time.Now()
+	strAction := fmt.Sprintf("\rCopying %s...", bkp.prepareName(path, fi.Name()))
+	var bkTo []BackupFolder
+	for _, dest := range dests {
+		bkTo = append(bkTo, *dest.dstBack)
+	}
+
+	errs := bkp.transferFileToAll(ctx, *bkp.srcBack, path, fi.Name(), bkTo, path, fi.Name(), fi.Size(), strAction)
+
+	duration := msSince(started)
+	if bkp.progress != nil {
+		bkp.progress.doneFiles++
+	}
+	for i, dest := range dests {
+		if errs[i] == nil {
+			dest.Statistics.NumFilesCopied++
+			dest.Statistics.SizeFilesCopied += fi.Size()
+			//set mode and time
+			errs[i] = bkTo[i].SetParams(path, fi.Name(), fi.ModTime(), fi.Mode())
+		}
+		if errs[i] != nil && ctx.Err() != nil {
+			dest.emit(Event{Event: EvSkipped, Path: bkp.prepareName(path, fi.Name()), Reason: "run cancelled"})
+			continue
+		}
+		if errs[i] != nil {
+			dest.emit(Event{Event: EvError, Path: bkp.prepareName(path, fi.Name()), Reason: "copy failed", Error: errs[i].Error()})
+			continue
+		}
+		dest.emit(Event{Event: EvCopied, Path: bkp.prepareName(path, fi.Name()), Size: fi.Size(), DurationMs: duration, Reason: reasons[i]})
+	}
+	return errs
+}
+
+// copies a single file from one location to another. The names may differ (as in the case of restoring an archived version)
+func (bkp *Backup) transferFile(ctx context.Context, bkFrom BackupFolder, fromPath string, fromName string, bkTo BackupFolder, toPath string, toName string, size int64, strAction string) error {
+	return bkp.transferFileToAll(ctx, bkFrom, fromPath, fromName, []BackupFolder{bkTo}, toPath, toName, size, strAction)[0]
+}
+
+// same as transferFile but to several locations at once. A copy that failed because a connection was lost
+// is started again (opening the files again reconnects, see ztReconnect).
+func (bkp *Backup) transferFileToAll(ctx context.Context, bkFrom BackupFolder, fromPath string, fromName string, bkTo []BackupFolder, toPath string, toName string, size int64, strAction string) []error {
+
+	errs := bkp.transferFileOnce(ctx, bkFrom, fromPath, fromName, bkTo, toPath, toName, size, strAction)
+	for attempt := 0; attempt < fileRestarts && ctx.Err() == nil; attempt++ {
+		var again []int
+		var bkAgain []BackupFolder
+		for i, err := range errs {
+			if isConnectionError(err) {
+				again = append(again, i)
+				bkAgain = append(bkAgain, bkTo[i])
+			}
+		}
+		if len(again) == 0 {
+			break
+		}
+		bkp.Println("\rConnection lost copying ", bkp.prepareName(fromPath, fromName), ". Starting it again")
+		errsAgain := bkp.transferFileOnce(ctx, bkFrom, fromPath, fromName, bkAgain, toPath, toName, size, strAction)
+		for j, i := range again {
+			errs[i] = errsAgain[j]
+		}
+	}
+	return errs
+}
+
+func (bkp *Backup) transferFileOnce(ctx context.Context, bkFrom BackupFolder, fromPath string, fromName string, bkTo []BackupFolder, toPath string, toName string, size int64, strAction string) []error {
+
+	errs := make([]error, len(bkTo))
+
+	src, err := bkFrom.Open(fromPath, fromName)
+	if err != nil {
+		bkp.Println("\rError opening source file ", bkp.prepareName(fromPath, fromName), " : ", err)
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
+	}
+
+	defer src.Close()
+
+	dsts := make([]io.WriteCloser, len(bkTo))
+	to := make([]io.Writer, len(bkTo))
+	for i, bk := range bkTo {
+		dsts[i], errs[i] = bk.Create(toPath, toName)
+		if errs[i] != nil {
+			bkp.Println("\rError creating/opening destination file ", bkp.prepareName(toPath, toName), " : ", errs[i])
+			continue
+		}
+		to[i] = dsts[i]
+	}
+	err = bkp.copyFileContents(ctx, bkp.prepareName(fromPath, fromName), src, to, errs, strAction, size, bkFrom == *bkp.srcBack)
+	//if copy fails delete the file so that it won't be left with half-finished job.
+	for i, bk := range bkTo {
+		if dsts[i] == nil {
+			continue
+		}
+		if errClose := dsts[i].Close(); errClose != nil && errs[i] == nil {
+			errs[i] = errClose //the last writes of a remote file can fail here
+		}
+		if err != nil && errs[i] == nil {
+			errs[i] = err
+		}
+		if errs[i] != nil {
+			bk.DeleteFile(toPath, toName)
+		}
+	}
+	return errs
+}
+
+// copies from to the destinations in to. A destination with an error (in errs) is skipped, and one that fails
+// gets its error in errs. counted is for a copy counted by PrescanFlag (not a restore).
+// Returns the read error, if any, or why the run was cancelled.
+func (bkp *Backup) copyFileContents(ctx context.Context, filePath string, from io.Reader, to []io.Writer, errs []error, strAction string, sizeEstimate int64, counted bool) error {
+
+	cm := &copyMeter{ctx: ctx, bkp: bkp, strAction: strAction, size: sizeEstimate, counted: counted, started: time.Now()}
+
+	//a single destination is written to directly, for its fast path
+	var dst io.Writer = &fanOut{bkp: bkp, filePath: filePath, to: to, errs: errs}
+	single, nActive := -1, 0
+	for i := range to {
+		if errs[i] == nil {
+			single = i
+			nActive++
+		}
+	}
+	switch nActive {
+	case 0:
+		return nil
+	case 1:
+		dst = to[single]
+	default:
+		single = -1
+	}
+
+	var err error
+	done := false
+	dstFile, dstLocal := dst.(*os.File)
+	srcFile, srcLocal := from.(*os.File)
+	if dstLocal && srcLocal {
+		done, err = copyLocal(cm, dstFile, srcFile) //or part of it
+	}
+	_, dstFast := dst.(io.ReaderFrom)
+	_, srcFast := from.(io.WriterTo)
+	switch {
+	case done:
+	case dstFast && fastPath(dst):
+		cm.r = from
+		_, err = io.CopyBuffer(dst, cm, bkp.copyBuffer)
+	case srcFast && fastPath(from):
+		cm.w = dst
+		_, err = io.CopyBuffer(cm, from, bkp.copyBuffer)
+	default:
+		cm.r = from
+		_, err = io.CopyBuffer(struct{ io.Writer }{dst}, cm, bkp.copyBuffer) //without the ReadFrom of a local file
+	}
+
+	readErr := (cm.r != nil) == (cm.innerErr != nil) //the meter wraps the reader and saw its error, or the writer and did not
+	switch {
+	case err == nil:
+		bkp.showProgress(strAction, -1)
+		return nil
+	case errors.Is(err, errNoDestination):
+		return nil
+	case cm.cancel != nil:
+		return cm.cancel //the partial copies are removed
+	case readErr || single < 0:
+		bkp.Println("\rRead error copying ", filePath, " : ", err)
+		return err
+	}
+	bkp.Println("\rWrite error copying ", filePath, " : ", err)
+	errs[single] = err
+	return nil
+}
+
+func (bkp *Backup) printStatistics() {
+	//char PrintBuf[4000];
+
+	bkp.LogPrintf("\r              \r\nEnded at %s\r\n", time.Now().Format(time.UnixDate))
+
+	elapsed := time.Since(bkp.started).Seconds()
+	for _, dest := range bkp.destinations() {
+		dest.Statistics.DurationSeconds = elapsed
+		dest.Statistics.NumRetries = (*dest.dstBack).Retries()
+		if dest == bkp {
+			dest.Statistics.NumRetries += (*bkp.srcBack).Retries()
+		}
+		if elapsed > 0 {
+			dest.Statistics.BytesPerSecond = float64(dest.Statistics.SizeFilesCopied+dest.Statistics.SizeFilesRestored) / elapsed
+		}
+		bkp.LogPrintf("%s", bkp.destinationStatistics(dest))
+		st := dest.Statistics
+		dest.emit(Event{Event: EvRunEnd, Source: bkp.srcLabel, Statistics: &st})
+	}
+}
+
+// the statistics of every destination, as printed at the end of the run. Empty if no run was started.
+func (bkp *Backup) StatisticsText() string {
+	if bkp.statPrinter == nil {
+		return ""
+	}
+	text := ""
+	for _, dest := range bkp.destinations() {
+		text += bkp.destinationStatistics(dest)
+	}
+	return text
+}
+
+func (bkp *Backup) destinationStatistics(dest *Backup) string {
+	text := ""
+	if len(bkp.mirrors) != 0 {
+		text = fmt.Sprintf("\r\nDestination: %s\r\n", dest.dstLabel)
+	}
+	return text + bkp.formatStatistics(dest.Statistics)
+}
+
+func (bkp *Backup) formatStatistics(st Statistics) string {
+	statful := bkp.statPrinter.Sprintf("\r\nFolders traversed            %15d\r\n", st.NumFolders)
+	statful += bkp.statPrinter.Sprintf("Files skipped                %15d\r\n", st.NumFilesSkipped)
+	if st.SizeFilesSkipped != 0 {
+		statful += bkp.statPrinter.Sprintf("Size of files skipped        %15d octets\r\n", st.SizeFilesSkipped)
+	}
+	statful += bkp.statPrinter.Sprintf("Files copied                 %15d\r\n", st.NumFilesCopied)
+	if st.SizeFilesCopied != 0 {
+		statful += bkp.statPrinter.Sprintf("Size of files copied         %15d octets\r\n", st.SizeFilesCopied)
+	}
+	statful += bkp.statPrinter.Sprintf("Files restored               %15d\r\n", st.NumFilesRestored)
+	if st.SizeFilesRestored != 0 {
+		statful += bkp.statPrinter.Sprintf("Size of files restored       %15d octets\r\n", st.SizeFilesRestored)
+	}
+	statful += bkp.statPrinter.Sprintf("Files deleted                %15d\r\n", st.NumFilesDeleted)
+	if st.SizeFilesDeleted != 0 {
+		statful += bkp.statPrinter.Sprintf("Size of files deleted        %15d octets\r\n", st.SizeFilesDeleted)
+	}
+	statful += bkp.statPrinter.Sprintf("Errors                       %15d\r\n", st.NumErrors)
+	if st.NumRetries != 0 {
+		statful += bkp.statPrinter.Sprintf("Retries                      %15d\r\n", st.NumRetries)
+	}
+	statful += bkp.statPrinter.Sprintf("Time taken                   %15s\r\n", (time.Duration(st.DurationSeconds * float64(time.Second))).Round(time.Second))
+	if st.BytesPerSecond != 0 {
+		statful += bkp.statPrinter.Sprintf("Throughput                   %15.0f octets/s\r\n", st.BytesPerSecond)
+	}
+	statful += "\r\n"
+
+	return statful
+}
@@ -0,0 +1,258 @@
+package ztbackup
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tzvetkoff-go/fnmatch"
+)
+
+// The catalog is a list of files present in each destination, kept under ~/.ztbackup/catalog so that
+// it can be searched (gozt find) without the destination being connected.
+//
+// Each destination is identified by a random id stored in a .ztid file at its root. That way a USB
+// drive keeps its identity no matter where it is mounted. There is one catalog file per destination,
+// named after the id: the first line describes the destination and each following line is a file.
+const catalogFolder = "catalog"
+const catalogIdFile = ".ztid"
+const catalogCurrent = "current"
+
+type CatalogHeader struct {
+	Id      string    `json:"id"`
+	Label   string    `json:"label"`
+	Updated time.Time `json:"updated"`
+}
+
+type CatalogEntry struct {
+	Path    string    `json:"path"` //relative to the root of the destination
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	Version string    `json:"version"` //"current" or the time the file was replaced (see .ztversions)
+}
+
+type ztCatalog struct {
+	header  CatalogHeader
+	old     []CatalogEntry
+	entries []CatalogEntry
+
+	visited map[string]bool //folders listed during this run
+	removed []string        //folders deleted during this run
+	current map[string]int  //the index in entries of the current version of each file
+}
+
+// strips the password (if any) from remote URLs and makes local paths absolute
+func FolderLabel(szPath string) string {
+	if strings.HasPrefix(szPath, "smb://") || strings.HasPrefix(szPath, "sftp://") || strings.HasPrefix(szPath, "ssh://") {
+		foldURL, err := url.Parse(szPath)
+		if err != nil {
+			return szPath
+		}
+		if foldURL.User != nil {
+			foldURL.User = url.User(foldURL.User.Username())
+		}
+		return foldURL.String()
+	}
+	abs, err := filepath.Abs(szPath)
+	if err != nil {
+		return szPath
+	}
+	return abs
+}
+
+// reads the identity of the destination, creating it if not present
+func getFolderId(bkps BackupFolder) (string, error) {
+	if fl, err := bkps.Open("", catalogIdFile); err == nil {
+		scans := bufio.NewScanner(fl)
+		scans.Scan()
+		id := strings.TrimSpace(scans.Text())
+		fl.Close()
+		if len(id) != 0 {
+			return id, nil
+		}
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(buf)
+	fl, err := bkps.Create("", catalogIdFile)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.WriteString(fl, id+"\n")
+	if errClose := fl.Close(); err == nil {
+		err = errClose
+	}
+	return id, err
+}
+
+func getCatalogPath(id string) (string, error) {
+	dir, err := ZtFolder()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s%c%s%c%s.cat", dir, os.PathSeparator, catalogFolder, os.PathSeparator, id), nil
+}
+
+// the catalog files of all the destinations backed up so far (see LoadCatalogFile)
+func CatalogFiles() []string {
+	pattern, err := getCatalogPath("*")
+	if err != nil {
+		return nil
+	}
+	cats, _ := filepath.Glob(pattern)
+	return cats
+}
+
+func LoadCatalogFile(fPath string) (CatalogHeader, []CatalogEntry, error) {
+	var hdr CatalogHeader
+	var entries []CatalogEntry
+
+	fl, err := os.Open(fPath)
+	if err != nil {
+		return hdr, nil, err
+	}
+	defer fl.Close()
+
+	scans := bufio.NewScanner(fl)
+	scans.Buffer(make([]byte, 64*1024), 1024*1024)
+	if !scans.Scan() {
+		return hdr, nil, fmt.Errorf("empty catalog %s", fPath)
+	}
+	if err := json.Unmarshal(scans.Bytes(), &hdr); err != nil {
+		return hdr, nil, err
+	}
+	for scans.Scan() {
+		var ce CatalogEntry
+		if json.Unmarshal(scans.Bytes(), &ce) == nil {
+			entries = append(entries, ce)
+		}
+	}
+	return hdr, entries, scans.Err()
+}
+
+// prepares the catalog for the destination. Failures are not fatal; the backup goes on without a catalog.
+func (bkp *Backup) OpenCatalog(dst BackupFolder, szDst string) {
+	id, err := getFolderId(dst)
+	if err != nil {
+		bkp.Println("\rUnable to identify destination for the catalog : ", err)
+		return
+	}
+	var cat ztCatalog
+	cat.header = CatalogHeader{Id: id, Label: FolderLabel(szDst)}
+	cat.visited = make(map[string]bool)
+	cat.current = make(map[string]int)
+	if fPath, err := getCatalogPath(id); err == nil {
+		_, cat.old, _ = LoadCatalogFile(fPath)
+	}
+
+	bkp.catalog = &cat
+}
+
+func (cat *ztCatalog) folderListed(path string) {
+	cat.visited[path] = true
+}
+
+func (cat *ztCatalog) folderRemoved(path string) {
+	cat.removed = append(cat.removed, path)
+}
+
+func (cat *ztCatalog) addFile(path string, size int64, modTime time.Time, version string) {
+	if version == catalogCurrent {
+		cat.removeFile(path) //replaced
+		cat.current[path] = len(cat.entries)
+	}
+	cat.entries = append(cat.entries, CatalogEntry{Path: path, Size: size, ModTime: modTime, Version: version})
+}
+
+// the file was deleted (or replaced) after it was listed. e.g. at the end of the run, with ReviewFlag.
+func (cat *ztCatalog) removeFile(path string) {
+	if i, ok := cat.current[path]; ok {
+		cat.entries[i] = CatalogEntry{} //left out by Save
+		delete(cat.current, path)
+	}
+}
+
+// entries from earlier runs are kept for folders that were not listed this time (non-recursive or excluded)
+// and for old versions, which are never listed. Those stay in the versions folder even when their folder is
+// removed.
+func (cat *ztCatalog) keepOld(ce CatalogEntry) bool {
+	if ce.Version != catalogCurrent {
+		return true
+	}
+	for _, rm := range cat.removed {
+		if strings.HasPrefix(ce.Path, rm+string(os.PathSeparator)) {
+			return false
+		}
+	}
+	dir := ""
+	if i := strings.LastIndexByte(ce.Path, os.PathSeparator); i >= 0 {
+		dir = ce.Path[:i]
+	}
+	return !cat.visited[dir]
+}
+
+func (cat *ztCatalog) Save() error {
+	var entries []CatalogEntry
+	for _, ce := range cat.entries {
+		if len(ce.Path) != 0 {
+			entries = append(entries, ce)
+		}
+	}
+	for _, ce := range cat.old {
+		if cat.keepOld(ce) {
+			entries = append(entries, ce)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+
+	fPath, err := getCatalogPath(cat.header.Id)
+	if err != nil {
+		return err
+	}
+	os.MkdirAll(filepath.Dir(fPath), 0755)
+	fl, err := os.Create(fPath + ".tmp")
+	if err != nil {
+		return err
+	}
+	wr := bufio.NewWriter(fl)
+	enc := json.NewEncoder(wr)
+	cat.header.Updated = time.Now()
+	enc.Encode(cat.header)
+	for _, ce := range entries {
+		enc.Encode(ce)
+	}
+	if err := wr.Flush(); err != nil {
+		fl.Close()
+		return err
+	}
+	if err := fl.Close(); err != nil {
+		return err
+	}
+	return os.Rename(fPath+".tmp", fPath)
+}
+
+// a pattern with wildcards is matched against the file name and the full path. Otherwise, any path containing it matches.
+func CatalogMatch(pattern string, ce CatalogEntry) bool {
+	return PathMatch(pattern, ce.Path)
+}
+
+func PathMatch(pattern string, path string) bool {
+	if strings.ContainsAny(pattern, "*?[") {
+		return fnmatch.Match(pattern, filepath.Base(path), fnmatch.CaseFold) || fnmatch.Match(pattern, path, fnmatch.CaseFold)
+	}
+	return strings.Contains(strings.ToLower(path), strings.ToLower(pattern))
+}
@@ -0,0 +1,71 @@
+package ztbackup
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// the old versions of the files in a removed folder stay in the catalog, and can be restored
+func TestCatalogRemovedFolder(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	day := func(d int) time.Time { return time.Date(2026, 9, d, 0, 0, 0, 0, time.UTC) }
+	src, dst, target := t.TempDir(), t.TempDir(), t.TempDir()
+	file := filepath.Join(src, "docs", "a")
+	write := func(data string, mod time.Time) {
+		t.Helper()
+		if err := os.WriteFile(file, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(file, mod, mod)
+	}
+	run := func() {
+		t.Helper()
+		bkp := Backup{Options: Options{RecursiveFlag: true, VersionFlag: true, FileOption: OptDelete, FolderOption: OptDelete}}
+		if err := bkp.Run(context.Background(), src, []string{dst}, FolderOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second))) //versions are stamped to the second
+	}
+
+	os.Mkdir(filepath.Dir(file), 0o755)
+	write("first", day(2))
+	run()
+	write("second", day(4))
+	run() //"first" is archived
+	if err := os.RemoveAll(filepath.Dir(file)); err != nil {
+		t.Fatal(err)
+	}
+	run() //so is "second", and the folder is removed
+
+	cats := CatalogFiles()
+	if len(cats) != 1 {
+		t.Fatalf("%d catalogs", len(cats))
+	}
+	_, entries, err := LoadCatalogFile(cats[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	nVersions := 0
+	for _, ce := range entries {
+		if ce.Path == filepath.Join("docs", "a") {
+			if ce.Version == catalogCurrent {
+				t.Errorf("the removed file is still current")
+			}
+			nVersions++
+		}
+	}
+	if nVersions != 2 {
+		t.Errorf("%d versions of the removed file in the catalog. Expected 2", nVersions)
+	}
+
+	var bkp Backup
+	if err := bkp.Restore(context.Background(), dst, target, day(3), FolderOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(filepath.Join(target, "docs", "a")); err != nil || string(data) != "first" {
+		t.Errorf("restored %q, %v. Expected \"first\"", data, err)
+	}
+}
@@ -0,0 +1,125 @@
+package ztbackup
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+// A copy between two local files is left to the kernel where it can be (see copyLocal). Otherwise it goes
+// through io.CopyBuffer, so that the handles of the backends can use their fast paths: a remote destination
+// writes with ReadFrom (concurrent requests over SFTP), a remote source reads with WriteTo. The copyMeter wraps
+// the other side and counts the bytes as they go through: progress, bandwidth limit, pause (Display) and
+// cancellation.
+
+// no destination is left to write to. Each has its error in errs.
+var errNoDestination = errors.New("no destination left")
+
+type copyMeter struct {
+	ctx       context.Context
+	bkp       *Backup
+	strAction string
+	size      int64 //estimate, for the percentage
+	counted   bool  //a copy counted by --prescan (not a restore)
+	nTotal    int64
+	started   time.Time
+	cloned    bool //the file was cloned (see copyLocal): nothing went through, so the bandwidth limit does not apply
+
+	r        io.Reader //one of the two
+	w        io.Writer
+	innerErr error //of r or w. Any other error is from the other side.
+	cancel   error
+}
+
+func (cm *copyMeter) Read(p []byte) (int, error) {
+	n, err := cm.r.Read(p)
+	if err != nil && err != io.EOF {
+		cm.innerErr = err
+	}
+	if errCount := cm.count(n); errCount != nil {
+		return n, errCount
+	}
+	return n, err
+}
+
+func (cm *copyMeter) Write(p []byte) (int, error) {
+	n, err := cm.w.Write(p)
+	if err != nil {
+		cm.innerErr = err
+		return n, err
+	}
+	return n, cm.count(n)
+}
+
+// the size of what is read. sftp.File.ReadFrom writes concurrently when it is known.
+func (cm *copyMeter) Size() int64 {
+	return cm.size
+}
+
+// after n bytes went through. Returns the cause when the run was cancelled.
+func (cm *copyMeter) count(n int) error {
+	if n <= 0 {
+		return nil
+	}
+	bkp := cm.bkp
+	cm.nTotal += int64(n)
+	if bkp.Display != nil {
+		bkp.Display.Transferred(cm.ctx, int64(n))
+	}
+	if cm.ctx.Err() != nil {
+		cm.cancel = context.Cause(cm.ctx) //the partial copies are removed
+		return cm.cancel
+	}
+	if bkp.progress != nil && cm.counted {
+		bkp.progress.doneBytes += int64(n)
+	}
+	if bkp.BandwidthLimit > 0 && !cm.cloned {
+		due := time.Duration(float64(cm.nTotal) / float64(bkp.BandwidthLimit) * float64(time.Second))
+		select {
+		case <-cm.ctx.Done():
+		case <-time.After(due - time.Since(cm.started)):
+		}
+	}
+	percent := 100
+	if cm.size > 0 && cm.nTotal < cm.size {
+		percent = int(cm.nTotal * 100 / cm.size)
+	}
+	bkp.showProgress(cm.strAction, percent)
+	return nil
+}
+
+// writes to every destination that has no error yet. A write error only stops its own destination.
+type fanOut struct {
+	bkp      *Backup
+	filePath string //for the messages
+	to       []io.Writer
+	errs     []error
+}
+
+func (fo *fanOut) Write(p []byte) (int, error) {
+	nActive := 0
+	for i, w := range fo.to {
+		if fo.errs[i] != nil {
+			continue
+		}
+		if _, err := w.Write(p); err != nil {
+			fo.bkp.Println("\rWrite error copying ", fo.filePath, " : ", err)
+			fo.errs[i] = err
+			continue
+		}
+		nActive++
+	}
+	if nActive == 0 {
+		return 0, errNoDestination
+	}
+	return len(p), nil
+}
+
+// whether the ReadFrom/WriteTo of a handle is worth taking. Those of a local file only help between files and
+// sockets, and would fall back to a small buffer here.
+func fastPath(h any) bool {
+	_, local := h.(*os.File)
+	return !local
+}
@@ -0,0 +1,51 @@
+//go:build linux
+// +build linux
+
+package ztbackup
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// Between two local files (e.g. to a USB drive) the kernel does the copy with copy_file_range, in chunks so that
+// the progress, the bandwidth limit and cancellation still work. With ReflinkFlag, the file is first cloned
+// (FICLONE), which shares its blocks on btrfs and XFS instead of copying them. Nothing goes through for a clone,
+// so the bandwidth limit does not apply to it. Whatever they can't do (another file system, an older kernel,
+// an error) is left to the buffered copy, which goes on from where they stopped.
+const copyRangeChunk = 8 << 20
+
+// the system calls, replaced by the tests to see that they were used
+var (
+	fileClone     = unix.IoctlFileClone
+	copyFileRange = unix.CopyFileRange
+)
+
+// returns true if the file was copied (or the run cancelled, with the cause)
+func copyLocal(cm *copyMeter, dst *os.File, src *os.File) (bool, error) {
+	if cm.bkp.ReflinkFlag {
+		if fi, err := src.Stat(); err == nil && fileClone(int(dst.Fd()), int(src.Fd())) == nil {
+			cm.cloned = true
+			for left := fi.Size(); left > 0; left -= copyRangeChunk {
+				if errCount := cm.count(int(min(left, copyRangeChunk))); errCount != nil {
+					return true, errCount
+				}
+			}
+			return true, nil
+		}
+	}
+	for {
+		n, err := copyFileRange(int(src.Fd()), nil, int(dst.Fd()), nil, copyRangeChunk, 0)
+		if err != nil {
+			return false, nil
+		}
+		if n == 0 {
+			//some file systems (e.g. procfs, FUSE) report nothing to copy for files that have data
+			return cm.nTotal != 0, nil
+		}
+		if errCount := cm.count(n); errCount != nil {
+			return true, errCount
+		}
+	}
+}
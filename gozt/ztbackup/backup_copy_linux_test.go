@@ -0,0 +1,96 @@
+//go:build linux
+// +build linux
+
+package ztbackup
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestCopyLocal(t *testing.T) {
+	data := strings.Repeat("0123456789", 1000)
+	dir := t.TempDir()
+	srcPath, dstPath := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	if err := os.WriteFile(srcPath, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	//what the kernel did
+	nCloned, nCopied := 0, 0
+	defer func(clone func(int, int) error, copyRange func(int, *int64, int, *int64, int, int) (int, error)) {
+		fileClone, copyFileRange = clone, copyRange
+	}(fileClone, copyFileRange)
+	fileClone = func(destFd int, srcFd int) error {
+		err := unix.IoctlFileClone(destFd, srcFd)
+		if err == nil {
+			nCloned++
+		}
+		return err
+	}
+	copyFileRange = func(rfd int, roff *int64, wfd int, woff *int64, len int, flags int) (int, error) {
+		n, err := unix.CopyFileRange(rfd, roff, wfd, woff, len, flags)
+		nCopied += n
+		return n, err
+	}
+	copyFile := func(bkp *Backup) {
+		t.Helper()
+		src, err := os.Open(srcPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer src.Close()
+		dst, err := os.Create(dstPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer dst.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		errs := make([]error, 1)
+		err = bkp.copyFileContents(ctx, "src", src, []io.Writer{dst}, errs, "", int64(len(data)), false)
+		if copied, _ := os.ReadFile(dstPath); err != nil || errs[0] != nil || string(copied) != data {
+			t.Fatalf("local copy (reflink %v): err %v, errs %v, %d bytes copied", bkp.ReflinkFlag, err, errs, len(copied))
+		}
+	}
+	//whether the file system of dir can do them
+	supported := func(call func(dst *os.File, src *os.File) error) error {
+		src, _ := os.Open(srcPath)
+		defer src.Close()
+		dst, err := os.Create(dstPath)
+		if err != nil {
+			return err
+		}
+		defer dst.Close()
+		return call(dst, src)
+	}
+
+	if err := supported(func(dst *os.File, src *os.File) error {
+		_, err := unix.CopyFileRange(int(src.Fd()), nil, int(dst.Fd()), nil, 1, 0)
+		return err
+	}); err != nil {
+		t.Skip("copy_file_range not supported: ", err)
+	}
+	copyFile(&Backup{copyBuffer: make([]byte, 64)})
+	if nCopied != len(data) {
+		t.Errorf("%d bytes copied by the kernel. Expected %d", nCopied, len(data))
+	}
+
+	if err := supported(func(dst *os.File, src *os.File) error {
+		return unix.IoctlFileClone(int(dst.Fd()), int(src.Fd()))
+	}); err != nil {
+		t.Skip("FICLONE not supported: ", err)
+	}
+	nCopied = 0
+	//a clone transfers nothing: 1 byte per second does not slow it down
+	copyFile(&Backup{Options: Options{ReflinkFlag: true, BandwidthLimit: 1}, copyBuffer: make([]byte, 64)})
+	if nCloned != 1 || nCopied != 0 {
+		t.Errorf("%d clones and %d bytes copied. Expected the file to be cloned", nCloned, nCopied)
+	}
+}
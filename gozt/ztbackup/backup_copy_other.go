@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package ztbackup
+
+import "os"
+
+// copy_file_range and FICLONE are Linux only. The buffered copy is used.
+func copyLocal(cm *copyMeter, dst *os.File, src *os.File) (bool, error) {
+	return false, nil
+}
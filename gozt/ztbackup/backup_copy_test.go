@@ -0,0 +1,104 @@
+package ztbackup
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+type failingWriter struct{ err error }
+
+func (fw failingWriter) Write(p []byte) (int, error) { return 0, fw.err }
+
+// a remote file, as far as the fast path goes
+type readFromWriter struct {
+	bytes.Buffer
+	used bool
+}
+
+func (rw *readFromWriter) ReadFrom(r io.Reader) (int64, error) {
+	rw.used = true
+	return rw.Buffer.ReadFrom(r)
+}
+
+func TestCopyFileContents(t *testing.T) {
+	ctx := context.Background()
+	data := strings.Repeat("0123456789", 1000)
+	errWrite := errors.New("disk full")
+	errRead := errors.New("connection reset")
+	bkp := &Backup{copyBuffer: make([]byte, 64)}
+
+	//a failed destination does not stop the others
+	var b1 bytes.Buffer
+	errs := make([]error, 2)
+	err := bkp.copyFileContents(ctx, "a", strings.NewReader(data), []io.Writer{failingWriter{errWrite}, &b1}, errs, "", int64(len(data)), false)
+	if err != nil || errs[0] != errWrite || errs[1] != nil || b1.String() != data {
+		t.Errorf("copy to two destinations: err %v, errs %v, %d bytes copied", err, errs, b1.Len())
+	}
+
+	//a single destination is written to with its ReadFrom
+	rw := &readFromWriter{}
+	errs = make([]error, 1)
+	err = bkp.copyFileContents(ctx, "a", strings.NewReader(data), []io.Writer{rw}, errs, "", int64(len(data)), false)
+	if err != nil || errs[0] != nil || !rw.used || rw.String() != data {
+		t.Errorf("copy with ReadFrom: err %v, errs %v, used %v", err, errs, rw.used)
+	}
+
+	//its write error is its own, a read error is everyone's
+	errs = make([]error, 1)
+	err = bkp.copyFileContents(ctx, "a", strings.NewReader(data), []io.Writer{failingWriter{errWrite}}, errs, "", 0, false)
+	if err != nil || !errors.Is(errs[0], errWrite) {
+		t.Errorf("write error: err %v, errs %v", err, errs)
+	}
+	errs = make([]error, 2)
+	src := io.MultiReader(strings.NewReader(data), iotest.ErrReader(errRead))
+	err = bkp.copyFileContents(ctx, "a", src, []io.Writer{&bytes.Buffer{}, &bytes.Buffer{}}, errs, "", 0, false)
+	if !errors.Is(err, errRead) || errs[0] != nil || errs[1] != nil {
+		t.Errorf("read error: err %v, errs %v", err, errs)
+	}
+
+	//cancelled
+	ctxCancel, cancel := context.WithCancelCause(ctx)
+	cancel(ErrCancelled)
+	errs = make([]error, 1)
+	err = bkp.copyFileContents(ctxCancel, "a", strings.NewReader(data), []io.Writer{&bytes.Buffer{}}, errs, "", 0, false)
+	if !errors.Is(err, ErrCancelled) {
+		t.Errorf("cancelled copy returned %v", err)
+	}
+
+	//between local files (by the kernel where it can), cloned or not
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "src"), []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, reflink := range []bool{false, true} {
+		bkp.ReflinkFlag = reflink
+		for _, c := range []context.Context{ctx, ctxCancel} {
+			src, err := os.Open(filepath.Join(dir, "src"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			dst, err := os.Create(filepath.Join(dir, "dst"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			errs = make([]error, 1)
+			err = bkp.copyFileContents(c, "src", src, []io.Writer{dst}, errs, "", int64(len(data)), false)
+			src.Close()
+			dst.Close()
+			copied, _ := os.ReadFile(filepath.Join(dir, "dst"))
+			switch {
+			case c == ctxCancel && !errors.Is(err, ErrCancelled):
+				t.Errorf("cancelled local copy (reflink %v) returned %v", reflink, err)
+			case c == ctx && (err != nil || errs[0] != nil || string(copied) != data):
+				t.Errorf("local copy (reflink %v): err %v, errs %v, %d bytes copied", reflink, err, errs, len(copied))
+			}
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package ztbackup
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Every action is reported as an Event to OnEvent (e.g. printed as JSON with --output=json).
+// Every action (but not the files and folders that needed none) is also recorded in the log.
+const (
+	EvRunStart = "run_start"
+	EvRunEnd   = "run_end"
+	EvFolder   = "folder"
+	EvCopied   = "copied"
+	EvSkipped  = "skipped"
+	EvRestored = "restored"
+	EvDeleted  = "deleted"
+	EvArchived = "archived" //moved to .ztversions instead of being overwritten/deleted
+	EvPrompt   = "prompt"
+	EvError    = "error"
+)
+
+// Display shows the progress of the copies, in place of the progress lines printed to the Console.
+type Display interface {
+	Transfer(action string, percent int, overall string) //the file being copied. percent is -1 when done. overall with PrescanFlag.
+	Transferred(ctx context.Context, n int64)            //n bytes were copied (0 between files). May block, e.g. while paused.
+}
+
+type Event struct {
+	Time        time.Time   `json:"time"`
+	Event       string      `json:"event"`
+	Path        string      `json:"path,omitempty"` //relative to the source/destination folder
+	Source      string      `json:"source,omitempty"`
+	Destination string      `json:"destination,omitempty"`
+	Size        int64       `json:"size,omitempty"`
+	DurationMs  float64     `json:"duration_ms,omitempty"`
+	Reason      string      `json:"reason,omitempty"`
+	Question    string      `json:"question,omitempty"`
+	Answer      string      `json:"answer,omitempty"`
+	Defaulted   bool        `json:"defaulted,omitempty"` //the question timed out (or could not be asked)
+	Error       string      `json:"error,omitempty"`
+	Statistics  *Statistics `json:"statistics,omitempty"`
+
+	noAudit bool //nothing was done. Not worth a line in the log.
+}
+
+// where the human readable output goes.
+func (bkp *Backup) console() io.Writer {
+	if bkp.Console == nil {
+		return io.Discard
+	}
+	return bkp.Console
+}
+
+func (bkp *Backup) Printf(format string, a ...any) {
+	fmt.Fprintf(bkp.console(), format, a...)
+}
+
+func (bkp *Backup) Println(a ...any) {
+	fmt.Fprintln(bkp.console(), a...)
+}
+
+func (bkp *Backup) emit(ev Event) {
+	if ev.Event == EvError {
+		bkp.Statistics.NumErrors++
+	}
+	if !ev.noAudit && ev.Event != EvFolder {
+		bkp.audit(ev)
+	}
+	if bkp.OnEvent == nil {
+		return
+	}
+	if len(ev.Source) != 0 {
+		ev.Source = FolderLabel(ev.Source)
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	if len(ev.Destination) == 0 && len(bkp.dstLabel) != 0 {
+		ev.Destination = FolderLabel(bkp.dstLabel)
+	}
+	bkp.OnEvent(ev)
+}
+
+// the log of the primary destination is shared by the additional ones
+func (bkp *Backup) audit(ev Event) {
+	ztl := bkp.auditLog
+	if ztl == nil {
+		ztl = &bkp.Log
+	}
+	ztl.Audit(ev.auditLine(FolderLabel(bkp.dstLabel)))
+}
+
+// e.g. copied    Documents/a.txt size=8 reason="source newer by 1h0m0s" destination=/mnt/backup
+func (ev *Event) auditLine(destination string) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%-9s %s", ev.Event, ev.Path)
+	if len(ev.Source) != 0 {
+		fmt.Fprintf(&sb, " source=%s", FolderLabel(ev.Source))
+	}
+	if ev.Size != 0 {
+		fmt.Fprintf(&sb, " size=%d", ev.Size)
+	}
+	if len(ev.Reason) != 0 {
+		fmt.Fprintf(&sb, " reason=%q", ev.Reason)
+	}
+	if len(ev.Question) != 0 {
+		fmt.Fprintf(&sb, " question=%q answer=%s", ev.Question, ev.Answer)
+		if ev.Defaulted {
+			sb.WriteString(" (default)")
+		}
+	}
+	if len(ev.Error) != 0 {
+		fmt.Fprintf(&sb, " error=%q", ev.Error)
+	}
+	if len(destination) != 0 {
+		fmt.Fprintf(&sb, " destination=%s", destination)
+	}
+	return sb.String()
+}
+
+// prints the error and reports it as an event
+func (bkp *Backup) reportError(path string, msg string, err error) {
+	bkp.Println("\r"+msg, path, " : ", err)
+	bkp.emit(Event{Event: EvError, Path: path, Reason: msg, Error: err.Error()})
+}
+
+// an error on the source side is one for every destination
+func (bkp *Backup) reportSourceError(path string, msg string, err error) {
+	bkp.Println("\r"+msg, path, " : ", err)
+	for _, dest := range bkp.destinations() {
+		dest.emit(Event{Event: EvError, Path: path, Reason: msg, Error: err.Error()})
+	}
+}
+
+func msSince(t time.Time) float64 {
+	return float64(time.Since(t).Microseconds()) / 1000
+}
+
+// a readable difference in modification times. e.g. "3h0m0s"
+func describeAge(d time.Duration) string {
+	if d >= time.Hour {
+		d = d.Round(time.Minute)
+	} else {
+		d = d.Round(time.Second)
+	}
+	return d.String()
+}
@@ -0,0 +1,216 @@
+package ztbackup
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// settings for connecting to a folder (as opposed to the settings for the backup itself)
+type FolderOptions struct {
+	SshKey  string          //private key for sftp. If empty, ~/.ssh/id_rsa or ~/.ssh/id_ed25519 is used.
+	Context context.Context //stops the retries after a lost connection (SMB, SFTP) when done. Run and Restore set their own.
+	Log     *ZtLog          //where a destination being created or a lost connection is logged. Run and Restore set theirs.
+}
+
+// Why a folder could not be opened. Test with errors.Is on the error returned by Initialize, e.g.
+// errors.Is(err, ErrAuthFailed). Other problems (e.g. a destination that could not be created) have no kind.
+var (
+	ErrInvalidURL      = errors.New("invalid folder or URL")
+	ErrHostUnreachable = errors.New("host unreachable")
+	ErrAuthFailed      = errors.New("authentication failed")
+	ErrShareMissing    = errors.New("share not found")
+	ErrFolderMissing   = errors.New("folder does not exist")
+	ErrNotAFolder      = errors.New("not a folder")
+)
+
+// returned by Initialize (and the InitializeToPath... functions) when the folder could not be opened
+type FolderError struct {
+	Folder string //the folder or URL, without the password
+	Kind   error  //one of the Err... above. nil if none applies.
+	Err    error  //what went wrong
+}
+
+func (fe *FolderError) Error() string {
+	return fmt.Sprintf("%s : %v", fe.Folder, fe.Err)
+}
+
+func (fe *FolderError) Unwrap() []error {
+	if fe.Kind == nil {
+		return []error{fe.Err}
+	}
+	return []error{fe.Kind, fe.Err}
+}
+
+func newFolderError(szPath string, kind error, err error) error {
+	return &FolderError{Folder: FolderLabel(szPath), Kind: kind, Err: err}
+}
+
+func Initialize(szPath string, pSrc BackupFolder) (BackupFolder, error) {
+	return InitializeWithOptions(szPath, pSrc, FolderOptions{})
+}
+
+// opens the folder. With pSrc (i.e. for a destination), the folder is created if it does not exist.
+func InitializeWithOptions(szPath string, pSrc BackupFolder, fo FolderOptions) (BackupFolder, error) {
+
+	//fix2: IsLocal (or IsAbs) in Linux returns true for remote folder as well
+	// but that test is required in Windows. So, we test for smb and sftp first.
+	if !strings.HasPrefix(szPath, "smb://") && !strings.HasPrefix(szPath, "sftp://") {
+		if filepath.IsAbs(szPath) || filepath.IsLocal(szPath) {
+			return InitializeToPathLocal(szPath, pSrc, fo)
+		}
+	}
+
+	//TODO: In case of windows, handle \\server\share kind of URLs.
+
+	//now the remote URLs
+	foldURL, err := url.Parse(szPath)
+	if err != nil {
+		return nil, &FolderError{Folder: szPath, Kind: ErrInvalidURL, Err: err} //not parsed, so the password can't be left out
+	}
+	switch foldURL.Scheme {
+	case "smb":
+		return InitializeToPathSmb(foldURL, pSrc, fo)
+	case "sftp", "ssh":
+		return InitializeToPathSftp(foldURL, pSrc, fo)
+	}
+	return nil, newFolderError(szPath, ErrInvalidURL, fmt.Errorf("unknown or invalid folder/URL scheme '%s'", foldURL.Scheme))
+}
+
+// replaces a leading ~ with the home folder
+func ExpandHome(szPath string) string {
+	if szPath != "~" && !strings.HasPrefix(szPath, "~/") {
+		return szPath
+	}
+	hdir, err := os.UserHomeDir()
+	if err != nil {
+		return szPath
+	}
+	return hdir + szPath[1:]
+}
+
+// A folder (local, SMB share or SFTP) that is backed up or backed up to. Paths are relative to RootFolder.
+// Open and Create return handles of their own, so that several files (of the same folder too) can be open
+// at once. A handle is also an io.ReaderAt, io.Seeker, io.WriterTo or io.ReaderFrom where the backend supports it.
+type BackupFolder interface {
+	Perm() fs.FileMode //for the folders created
+	//getUrl() *url.URL
+	RootFolder() string
+
+	Stat(name string) (fs.FileInfo, error)
+	MkdirAll(path string, perm fs.FileMode) error
+	ReadFolder(dirname string) ([]os.FileInfo, error)
+	Open(path string, name string) (io.ReadCloser, error)
+	Create(path string, name string) (io.WriteCloser, error) //truncated if the file exists
+	//whole (small) files
+	CreateNewFile(path string, name string, data []byte) error //fails with fs.ErrExist if the file exists
+	ReadWholeFile(path string, name string) ([]byte, error)
+	FreeSpace() (free int64, total int64, err error) //of the file system holding the root folder
+	DeleteFile(path string, name string) error
+	RemoveAll(path string) error
+	Rename(oldpath string, newpath string) error
+	SetParams(path string, name string, modTime time.Time, perm fs.FileMode) error
+
+	SetRootMode(fm fs.FileMode)
+	Retries() int64 //operations retried after reconnecting
+	Close()
+}
+
+func getBackupFolderType(pSrc BackupFolder) string {
+	if pSrc == nil {
+		return "Source"
+	}
+	return "Destination"
+}
+
+func prepareTargetName(bkps BackupFolder, path string, name string) string {
+	if len(path) == 0 {
+		if len(name) == 0 {
+			return bkps.RootFolder()
+		}
+		return fmt.Sprintf("%s%c%s", bkps.RootFolder(), os.PathSeparator, name)
+	}
+	if len(name) == 0 {
+		return fmt.Sprintf("%s%c%s", bkps.RootFolder(), os.PathSeparator, path)
+	}
+	return fmt.Sprintf("%s%c%s%c%s", bkps.RootFolder(), os.PathSeparator, path, os.PathSeparator, name)
+}
+
+func getFileInfo(bkps BackupFolder, path string, name string) (fs.FileInfo, error) {
+	return bkps.Stat(prepareTargetName(bkps, path, name))
+}
+
+func ReadDir(bkps BackupFolder, dirname string) ([]os.FileInfo, error) {
+	var readex string
+
+	if len(dirname) == 0 {
+		readex = bkps.RootFolder()
+	} else {
+		readex = fmt.Sprintf("%s%c%s", bkps.RootFolder(), os.PathSeparator, dirname)
+	}
+	return bkps.ReadFolder(readex)
+}
+
+// checks that the root folder exists (creating it for a destination) and takes its mode. szPath is
+// the folder or URL, for the error. A destination created is logged to ztl, if not nil.
+func checkExists(bkps BackupFolder, pSrc BackupFolder, szPath string, ztl *ZtLog) error {
+	//check if folder exists.
+	fst, err := bkps.Stat(bkps.RootFolder())
+	if errors.Is(err, fs.ErrNotExist) {
+		if pSrc == nil {
+			return newFolderError(szPath, ErrFolderMissing, fmt.Errorf("specified source folder '%s' does not exist", bkps.RootFolder()))
+		}
+		if ztl != nil {
+			ztl.Printf("\rSpecified destination folder '%s' does not exist. Creating.\r\n", bkps.RootFolder())
+		}
+		if errDir := bkps.MkdirAll(bkps.RootFolder(), pSrc.Perm()); errDir != nil {
+			return newFolderError(szPath, nil, fmt.Errorf("error creating destination folder: %w", errDir))
+		}
+		fst, err = bkps.Stat(bkps.RootFolder()) //stat again. just to make sure.
+		if err != nil {
+			return newFolderError(szPath, nil, fmt.Errorf("error creating destination folder: %w", err))
+		}
+	} else if err != nil {
+		return newFolderError(szPath, nil, fmt.Errorf("error checking %s folder: %w", strings.ToLower(getBackupFolderType(pSrc)), err))
+	}
+	if !fst.IsDir() { //exists, but not a folder
+		return newFolderError(szPath, ErrNotAFolder, fmt.Errorf("'%s' exists but is not a folder", bkps.RootFolder()))
+	}
+	bkps.SetRootMode(fst.Mode())
+	return nil
+}
+
+func loadExcludeList(bkps BackupFolder, path string) []string {
+	fl, err := bkps.Open(path, ".ztexclude")
+	if err != nil {
+		return nil
+	}
+	defer fl.Close()
+
+	scans := bufio.NewScanner(fl)
+
+	//exList := make([]string, 5)
+	var exList []string
+
+	scans.Split(bufio.ScanLines)
+
+	for scans.Scan() {
+		exItem := strings.TrimSpace(scans.Text())
+		if len(exItem) != 0 {
+			exList = append(exList, exItem)
+		}
+	}
+
+	if len(exList) != 0 {
+		return exList
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package ztbackup
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInitializeErrors(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path string
+		kind error
+	}{
+		{filepath.Join(dir, "missing"), ErrFolderMissing},
+		{file, ErrNotAFolder},
+		{"sftp://host/folder", ErrInvalidURL}, //no user
+	}
+	for _, tt := range tests {
+		bkps, err := Initialize(tt.path, nil)
+		if bkps != nil || !errors.Is(err, tt.kind) {
+			t.Errorf("Initialize(%q) = %v, %v. Expected %v", tt.path, bkps, err, tt.kind)
+		}
+		var fe *FolderError
+		if !errors.As(err, &fe) {
+			t.Errorf("Initialize(%q): %v is not a FolderError", tt.path, err)
+		}
+	}
+}
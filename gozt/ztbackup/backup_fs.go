@@ -0,0 +1,299 @@
+package ztbackup
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Backup folders and io/fs. A FolderFS lets the standard tools (fs.WalkDir, http.FS, template.ParseFS etc.) read
+// any BackupFolder, e.g. a backup on an SMB share or over SFTP. An FSBackupFolder is the reverse: a read-only
+// BackupFolder over any fs.FS (an embed.FS, an fstest.MapFS, a zip.Reader), to be backed up with RunFrom.
+
+// FolderFS is an fs.FS (with fs.ReadDirFS and fs.StatFS) over a BackupFolder, rooted at its RootFolder.
+// Its files are also an io.Seeker and io.ReaderAt where the backend supports them (all of gozt's do).
+type FolderFS struct {
+	bkps BackupFolder
+}
+
+func NewFolderFS(bkps BackupFolder) *FolderFS {
+	return &FolderFS{bkps: bkps}
+}
+
+// the name in the folder. op is for the error.
+func (ffs *FolderFS) target(op string, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return ffs.bkps.RootFolder(), nil
+	}
+	return prepareTargetName(ffs.bkps, "", filepath.FromSlash(name)), nil
+}
+
+// the error of a backend, for name (as the fs.FS was given it)
+func fsPathError(op string, name string, err error) error {
+	var pe *fs.PathError
+	if errors.As(err, &pe) {
+		err = pe.Err
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+func (ffs *FolderFS) Open(name string) (fs.File, error) {
+	fi, err := ffs.stat("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		return &folderFSDir{ffs: ffs, name: name, info: fi}, nil
+	}
+	dir, base := path.Split(name)
+	rc, err := ffs.bkps.Open(filepath.FromSlash(strings.TrimSuffix(dir, "/")), base)
+	if err != nil {
+		return nil, fsPathError("open", name, err)
+	}
+	return &folderFSFile{ReadCloser: rc, name: name, info: fi}, nil
+}
+
+func (ffs *FolderFS) Stat(name string) (fs.FileInfo, error) {
+	return ffs.stat("stat", name)
+}
+
+func (ffs *FolderFS) stat(op string, name string) (fs.FileInfo, error) {
+	target, err := ffs.target(op, name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := ffs.bkps.Stat(target)
+	if err != nil {
+		return nil, fsPathError(op, name, err)
+	}
+	return fi, nil
+}
+
+// sorted by name
+func (ffs *FolderFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	target, err := ffs.target("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	fis, err := ffs.bkps.ReadFolder(target)
+	if err != nil {
+		return nil, fsPathError("readdir", name, err)
+	}
+	entries := make([]fs.DirEntry, 0, len(fis))
+	for _, fi := range fis {
+		entries = append(entries, fs.FileInfoToDirEntry(fi))
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+type folderFSFile struct {
+	io.ReadCloser
+	name string
+	info fs.FileInfo
+}
+
+func (f *folderFSFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *folderFSFile) Seek(offset int64, whence int) (int64, error) {
+	if sk, ok := f.ReadCloser.(io.Seeker); ok {
+		return sk.Seek(offset, whence)
+	}
+	return 0, &fs.PathError{Op: "seek", Path: f.name, Err: errors.ErrUnsupported}
+}
+
+func (f *folderFSFile) ReadAt(p []byte, off int64) (int, error) {
+	if ra, ok := f.ReadCloser.(io.ReaderAt); ok {
+		return ra.ReadAt(p, off)
+	}
+	return 0, &fs.PathError{Op: "readat", Path: f.name, Err: errors.ErrUnsupported}
+}
+
+// a folder opened with FolderFS.Open. It is listed on the first ReadDir.
+type folderFSDir struct {
+	ffs     *FolderFS
+	name    string
+	info    fs.FileInfo
+	entries []fs.DirEntry
+	listed  bool
+}
+
+func (d *folderFSDir) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *folderFSDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: errors.New("is a directory")}
+}
+
+func (d *folderFSDir) Close() error {
+	return nil
+}
+
+func (d *folderFSDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.listed {
+		entries, err := d.ffs.ReadDir(d.name)
+		if err != nil {
+			return nil, err
+		}
+		d.entries, d.listed = entries, true
+	}
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(d.entries))
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
+
+// ErrReadOnly is returned by the changes to an FSBackupFolder.
+var ErrReadOnly = fmt.Errorf("read-only folder: %w", fs.ErrPermission)
+
+// FSBackupFolder is a read-only BackupFolder over an fs.FS, to be backed up (see RunFrom).
+type FSBackupFolder struct {
+	fsys     fs.FS
+	rootPerm fs.FileMode
+}
+
+// opens fsys as a source folder
+func InitializeFromFS(fsys fs.FS) (BackupFolder, error) {
+	bkps := &FSBackupFolder{fsys: fsys}
+	if err := checkExists(bkps, nil, "fs.FS", nil); err != nil {
+		return nil, err
+	}
+	return bkps, nil
+}
+
+// The files of an fs.FS are often read-only (embed.FS) or have no permissions at all (fstest.MapFS). Their copies
+// are made readable and writable by the owner. A missing modification time (embed.FS) is reported as the Unix
+// epoch, which the copies can be given, so that the files are compared by their size.
+type fsFileInfo struct {
+	fs.FileInfo
+}
+
+func (fi fsFileInfo) Mode() fs.FileMode {
+	if fi.IsDir() {
+		return fi.FileInfo.Mode() | 0700
+	}
+	return fi.FileInfo.Mode() | 0600
+}
+
+func (fi fsFileInfo) ModTime() time.Time {
+	if fi.FileInfo.ModTime().IsZero() {
+		return time.Unix(0, 0)
+	}
+	return fi.FileInfo.ModTime()
+}
+
+// the name in the fs.FS of a name prepared with the RootFolder (".")
+func (bkps *FSBackupFolder) fsName(name string) string {
+	return path.Clean(filepath.ToSlash(name))
+}
+
+func (bkps *FSBackupFolder) readOnly(op string, name string) error {
+	return &fs.PathError{Op: op, Path: name, Err: ErrReadOnly}
+}
+
+func (bkps *FSBackupFolder) Perm() fs.FileMode {
+	return bkps.rootPerm
+}
+
+func (bkps *FSBackupFolder) RootFolder() string {
+	return "."
+}
+
+func (bkps *FSBackupFolder) SetRootMode(fm fs.FileMode) {
+	bkps.rootPerm = fm
+}
+
+func (bkps *FSBackupFolder) Retries() int64 {
+	return 0
+}
+
+func (bkps *FSBackupFolder) Stat(name string) (fs.FileInfo, error) {
+	fi, err := fs.Stat(bkps.fsys, bkps.fsName(name))
+	if err != nil {
+		return nil, err
+	}
+	return fsFileInfo{fi}, nil
+}
+
+func (bkps *FSBackupFolder) ReadFolder(dirname string) ([]os.FileInfo, error) {
+	entries, err := fs.ReadDir(bkps.fsys, bkps.fsName(dirname))
+	if err != nil {
+		return nil, err
+	}
+	fis := make([]os.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		fi, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		fis = append(fis, fsFileInfo{fi})
+	}
+	return fis, nil
+}
+
+func (bkps *FSBackupFolder) Open(path string, name string) (io.ReadCloser, error) {
+	return bkps.fsys.Open(bkps.fsName(prepareTargetName(bkps, path, name)))
+}
+
+func (bkps *FSBackupFolder) ReadWholeFile(path string, name string) ([]byte, error) {
+	return fs.ReadFile(bkps.fsys, bkps.fsName(prepareTargetName(bkps, path, name)))
+}
+
+func (bkps *FSBackupFolder) FreeSpace() (int64, int64, error) {
+	return 0, 0, errors.ErrUnsupported
+}
+
+func (bkps *FSBackupFolder) Create(path string, name string) (io.WriteCloser, error) {
+	return nil, bkps.readOnly("create", prepareTargetName(bkps, path, name))
+}
+
+func (bkps *FSBackupFolder) CreateNewFile(path string, name string, data []byte) error {
+	return bkps.readOnly("create", prepareTargetName(bkps, path, name))
+}
+
+func (bkps *FSBackupFolder) MkdirAll(path string, perm fs.FileMode) error {
+	return bkps.readOnly("mkdir", path)
+}
+
+func (bkps *FSBackupFolder) DeleteFile(path string, name string) error {
+	return bkps.readOnly("remove", prepareTargetName(bkps, path, name))
+}
+
+func (bkps *FSBackupFolder) RemoveAll(path string) error {
+	return bkps.readOnly("remove", prepareTargetName(bkps, path, ""))
+}
+
+func (bkps *FSBackupFolder) Rename(oldpath string, newpath string) error {
+	return bkps.readOnly("rename", oldpath)
+}
+
+func (bkps *FSBackupFolder) SetParams(path string, name string, modTime time.Time, perm fs.FileMode) error {
+	return bkps.readOnly("chtimes", prepareTargetName(bkps, path, name))
+}
+
+func (bkps *FSBackupFolder) Close() {
+	if cl, ok := bkps.fsys.(io.Closer); ok { //e.g. a zip.ReadCloser
+		cl.Close()
+	}
+}
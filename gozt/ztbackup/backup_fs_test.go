@@ -0,0 +1,130 @@
+package ztbackup
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestFolderFS(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "sub", "deeper"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string]string{"a.txt": "a", "sub/b.txt": "bb", "sub/deeper/c.txt": "ccc"} {
+		if err := os.WriteFile(filepath.Join(dir, filepath.FromSlash(name)), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bkps, err := Initialize(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bkps.Close()
+	if err := fstest.TestFS(NewFolderFS(bkps), "a.txt", "sub/b.txt", "sub/deeper/c.txt"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBackupFromFS(t *testing.T) {
+	t.Setenv("HOME", t.TempDir()) //for the catalog and the saved listings
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"a.txt":      {Data: []byte("a"), ModTime: modTime},
+		"sub/b.txt":  {Data: []byte("bb"), ModTime: modTime},
+		"notime.txt": {Data: []byte("no time")}, //as in an embed.FS
+	}
+	src, err := InitializeFromFS(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := src.Create("", "new.txt"); !errors.Is(err, ErrReadOnly) || !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("Create in an fs.FS returned %v", err)
+	}
+
+	dst := t.TempDir()
+	for run := 0; run < 2; run++ { //the second run finds everything backed up
+		bkp := Backup{Options: Options{RecursiveFlag: true}}
+		if err := bkp.RunFrom(context.Background(), src, "fstest", []string{dst}, FolderOptions{}); err != nil {
+			t.Fatalf("run %d: %v", run, err)
+		}
+		st := bkp.Statistics
+		if st.NumErrors != 0 || st.NumFilesRestored != 0 || st.NumFilesCopied != int64(3*(1-run)) {
+			t.Errorf("run %d: %+v", run, st)
+		}
+	}
+	for name, data := range map[string]string{"a.txt": "a", "sub/b.txt": "bb", "notime.txt": "no time"} {
+		path := filepath.Join(dst, filepath.FromSlash(name))
+		got, err := os.ReadFile(path)
+		if err != nil || string(got) != data {
+			t.Errorf("%s: %q, %v. Expected %q", name, got, err, data)
+			continue
+		}
+		fi, _ := os.Stat(path)
+		if expected := map[string]time.Time{"a.txt": modTime, "notime.txt": time.Unix(0, 0)}[name]; !expected.IsZero() && !fi.ModTime().Equal(expected) {
+			t.Errorf("%s: modified %v. Expected %v", name, fi.ModTime(), expected)
+		}
+		if fi.Mode().Perm()&0o600 != 0o600 {
+			t.Errorf("%s: mode %v is not writable by the owner", name, fi.Mode())
+		}
+	}
+}
+
+// a source whose "bad" file cannot be read and whose "unreadable" folder cannot be listed
+type failingFS struct {
+	fstest.MapFS
+}
+
+type failingFile struct {
+	fs.File
+}
+
+func (ff failingFile) Read(p []byte) (int, error) {
+	return 0, errors.New("read failed")
+}
+
+func (ffs failingFS) Open(name string) (fs.File, error) {
+	fl, err := ffs.MapFS.Open(name)
+	if err == nil && name == "bad" {
+		return failingFile{fl}, nil
+	}
+	return fl, err
+}
+
+func (ffs failingFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if name == "unreadable" {
+		return nil, fs.ErrPermission
+	}
+	return ffs.MapFS.ReadDir(name)
+}
+
+// the errors reading the source count for every destination
+func TestSourceErrorsMirrored(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	src, err := InitializeFromFS(failingFS{fstest.MapFS{
+		"good":         {Data: []byte("good")},
+		"bad":          {Data: []byte("bad")},
+		"unreadable/a": {Data: []byte("a")},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bkp := Backup{Options: Options{RecursiveFlag: true}}
+	if err := bkp.RunFrom(context.Background(), src, "failing", []string{t.TempDir(), t.TempDir()}, FolderOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	results := bkp.Results(nil)
+	if len(results) != 2 {
+		t.Fatalf("%d results", len(results))
+	}
+	for _, res := range results {
+		if st := res.Statistics; st.NumErrors != 2 || st.NumFilesCopied != 1 {
+			t.Errorf("%s: %+v. Expected 2 errors and 1 file copied", res.Destination, st)
+		}
+	}
+}
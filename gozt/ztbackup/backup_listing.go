@@ -0,0 +1,69 @@
+package ztbackup
+
+import (
+	"errors"
+	"io/fs"
+	"sort"
+	"strings"
+)
+
+// A folder is compared with its counterpart (source and destination) through their listings, one ReadFolder each,
+// rather than with a Stat for every file: over SMB and SFTP each Stat is a round trip. The two listings are sorted
+// and merged by name. A Stat is still made for a name that the other folder only has in another case, since it
+// may not tell the two apart (SMB, Windows, macOS), for a symbolic link (listed as itself, where Stat follows it)
+// and for every name when the other folder could not be listed.
+
+// the entries of a listing joined with those of the other folder
+type ztJoin struct {
+	bkps   BackupFolder //the other folder
+	path   string
+	other  []fs.FileInfo   //per entry of the listing, the entry of the other folder with the same name. nil if none.
+	folded map[string]bool //lower case names of the other folder. nil if it could not be listed.
+}
+
+// joins entries (a listing of path) with others, the listing of path in bkps. errOthers is the error (if any)
+// reading the latter. A folder that does not exist has nothing in it.
+func joinListings(entries []fs.FileInfo, bkps BackupFolder, path string, others []fs.FileInfo, errOthers error) *ztJoin {
+	join := &ztJoin{bkps: bkps, path: path, other: make([]fs.FileInfo, len(entries))}
+	if errOthers != nil && !errors.Is(errOthers, fs.ErrNotExist) {
+		return join
+	}
+	join.folded = make(map[string]bool, len(others))
+	for _, fi := range others {
+		join.folded[strings.ToLower(fi.Name())] = true
+	}
+
+	order := make([]int, len(entries))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return entries[order[i]].Name() < entries[order[j]].Name() })
+	sorted := append([]fs.FileInfo(nil), others...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name() < sorted[j].Name() })
+
+	for k, o := 0, 0; k < len(order) && o < len(sorted); {
+		name, otherName := entries[order[k]].Name(), sorted[o].Name()
+		switch {
+		case name < otherName:
+			k++
+		case name > otherName:
+			o++
+		default:
+			join.other[order[k]] = sorted[o]
+			k++
+			o++
+		}
+	}
+	return join
+}
+
+// the entry of the other folder for entry i (named name). The error is fs.ErrNotExist if there is none.
+func (join *ztJoin) find(i int, name string) (fs.FileInfo, error) {
+	if fi := join.other[i]; fi != nil && fi.Mode()&fs.ModeSymlink == 0 {
+		return fi, nil
+	}
+	if join.folded != nil && !join.folded[strings.ToLower(name)] {
+		return nil, &fs.PathError{Op: "stat", Path: prepareTargetName(join.bkps, join.path, name), Err: fs.ErrNotExist}
+	}
+	return getFileInfo(join.bkps, join.path, name)
+}
@@ -0,0 +1,71 @@
+package ztbackup
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+// counts the Stat calls
+type statCounter struct {
+	BackupFolder
+	nStat int
+}
+
+func (sc *statCounter) Stat(name string) (fs.FileInfo, error) {
+	sc.nStat++
+	return sc.BackupFolder.Stat(name)
+}
+
+func TestJoinListings(t *testing.T) {
+	src, err := InitializeFromFS(fstest.MapFS{"a": {}, "c": {}, "d": {}, "link": {Mode: fs.ModeSymlink}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := &statCounter{BackupFolder: src}
+	others, err := src.ReadFolder(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := InitializeFromFS(fstest.MapFS{"d": {}, "b": {}, "a": {}, "C": {}, "link": {}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	listing, _ := entries.ReadFolder(".")
+
+	join := joinListings(listing, other, "", others, nil)
+	for i, fi := range listing {
+		found, err := join.find(i, fi.Name())
+		switch fi.Name() {
+		case "a", "d":
+			if err != nil || found.Name() != fi.Name() {
+				t.Errorf("%s: %v, %v", fi.Name(), found, err)
+			}
+		case "b", "C": //"c" only differs in case: it is checked with Stat
+			if !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("%s: %v, %v. Expected not to exist", fi.Name(), found, err)
+			}
+		}
+	}
+	if other.nStat != 2 { //"C" and the symbolic link
+		t.Errorf("%d Stat calls. Expected 2", other.nStat)
+	}
+
+	//without the other listing, everything is looked up
+	other.nStat = 0
+	join = joinListings(listing, other, "", nil, fs.ErrPermission)
+	for i, fi := range listing {
+		join.find(i, fi.Name())
+	}
+	if other.nStat != len(listing) {
+		t.Errorf("%d Stat calls. Expected %d", other.nStat, len(listing))
+	}
+
+	//a missing folder has nothing in it
+	other.nStat = 0
+	join = joinListings(listing, other, "missing", nil, fs.ErrNotExist)
+	if _, err := join.find(0, listing[0].Name()); !errors.Is(err, fs.ErrNotExist) || other.nStat != 0 {
+		t.Errorf("in a missing folder: %v, %d Stat calls", err, other.nStat)
+	}
+}
@@ -0,0 +1,126 @@
+package ztbackup
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"time"
+)
+
+type LocalBackupFolder struct {
+	rootPerm fs.FileMode
+	//rootUrl  *url.URL
+
+	szRootPath string
+}
+
+func (bkps *LocalBackupFolder) Perm() fs.FileMode {
+	return bkps.rootPerm
+}
+
+func (bkps *LocalBackupFolder) RootFolder() string {
+	return bkps.szRootPath
+	//return bkps.rootUrl.Path
+}
+
+func (bkps *LocalBackupFolder) Retries() int64 {
+	return 0 //nothing to reconnect
+}
+
+func (bkps *LocalBackupFolder) SetRootMode(fm fs.FileMode) {
+	bkps.rootPerm = fm
+}
+
+func (bkps *LocalBackupFolder) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(name)
+}
+func (bkps *LocalBackupFolder) MkdirAll(path string, perm fs.FileMode) error {
+
+	return os.MkdirAll(path, perm)
+}
+
+func (bkps *LocalBackupFolder) ReadFolder(path string) ([]os.FileInfo, error) {
+	fpr, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+	defer fpr.Close()
+	return fpr.Readdir(0)
+}
+
+func (bkps *LocalBackupFolder) Open(path string, name string) (io.ReadCloser, error) {
+	fl, err := os.Open(prepareTargetName(bkps, path, name))
+	if err != nil {
+		return nil, err
+	}
+	return fl, nil
+}
+func (bkps *LocalBackupFolder) Create(path string, name string) (io.WriteCloser, error) {
+	fl, err := os.Create(prepareTargetName(bkps, path, name))
+	if err != nil {
+		return nil, err
+	}
+	return fl, nil
+}
+
+func (bkps *LocalBackupFolder) CreateNewFile(path string, name string, data []byte) error {
+	fl, err := os.OpenFile(prepareTargetName(bkps, path, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = fl.Write(data)
+	if errClose := fl.Close(); err == nil {
+		err = errClose
+	}
+	return err
+}
+
+func (bkps *LocalBackupFolder) ReadWholeFile(path string, name string) ([]byte, error) {
+	return os.ReadFile(prepareTargetName(bkps, path, name))
+}
+
+func (bkps *LocalBackupFolder) FreeSpace() (int64, int64, error) {
+	return diskFreeSpace(bkps.szRootPath)
+}
+
+func (bkps *LocalBackupFolder) SetParams(path string, name string, modTime time.Time, perm fs.FileMode) error {
+
+	pathstring := prepareTargetName(bkps, path, name)
+	err := os.Chtimes(pathstring, modTime, modTime)
+	err2 := os.Chmod(pathstring, perm)
+	if err != nil { //we will try and do both but return either error.
+		return err
+	}
+	return err2
+}
+
+func InitializeToPathLocal(szPath string, pSrc BackupFolder, fo FolderOptions) (BackupFolder, error) {
+	//just open the specified folder. if failed, probably no access?
+	var bkps LocalBackupFolder
+
+	bkps.szRootPath = szPath
+
+	//bkps.rootUrl = szUrl
+
+	if err := checkExists(&bkps, pSrc, szPath, fo.Log); err != nil {
+		return nil, err
+	}
+	return &bkps, nil
+}
+
+func (bkps *LocalBackupFolder) DeleteFile(path string, name string) error {
+	return os.Remove(prepareTargetName(bkps, path, name))
+}
+
+func (bkps *LocalBackupFolder) RemoveAll(path string) error {
+	return os.RemoveAll(prepareTargetName(bkps, path, ""))
+}
+
+func (bkps *LocalBackupFolder) Rename(oldpath string, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
+
+func (bkps *LocalBackupFolder) Close() {
+	//nothing to do here since we didn't open a connection
+}
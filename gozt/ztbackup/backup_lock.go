@@ -0,0 +1,226 @@
+package ztbackup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"runtime"
+	"syscall"
+	"time"
+)
+
+// A run locks every destination so that two runs (e.g. a slow cron job and the next one, or two machines
+// backing up to the same share) never copy, delete or restore in the same tree at the same time.
+//
+// The lock is a .ztlock file at the root of the destination with the host, PID and start time of the run.
+// It is created exclusively (which fails if it is already there) and its modification time is refreshed
+// every lockHeartbeat while the run goes on. A lock that has not been refreshed for lockStaleAfter, or that
+// was taken on this host by a process that is no longer running, is stale and is broken. --break-lock
+// breaks any lock.
+const lockFileName = ".ztlock"
+const lockHeartbeat = time.Minute
+const lockStaleAfter = 10 * time.Minute
+
+var ErrLocked = errors.New("locked by another run")
+
+// the lock file could not be created at all, e.g. on a read-only backup
+var errCannotLock = errors.New("unable to lock")
+
+type lockInfo struct {
+	Host    string    `json:"host"`
+	PID     int       `json:"pid"`
+	Started time.Time `json:"started"`
+}
+
+func (li lockInfo) String() string {
+	if len(li.Host) == 0 {
+		return "an unknown run"
+	}
+	return fmt.Sprintf("PID %d on %s since %s", li.PID, li.Host, li.Started.Local().Format(time.DateTime))
+}
+
+type ztLock struct {
+	bkps  BackupFolder
+	label string
+	info  lockInfo
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// reads the lock held on the destination (or one moved aside, see moveAside). The lock info is empty if the
+// file could not be parsed (e.g. a run died while creating it).
+func readLock(bkps BackupFolder, name string) (lockInfo, fs.FileInfo, error) {
+	var li lockInfo
+	fi, err := bkps.Stat(prepareTargetName(bkps, "", name))
+	if err != nil {
+		return li, nil, err
+	}
+	if data, err := bkps.ReadWholeFile("", name); err == nil {
+		json.Unmarshal(data, &li)
+	}
+	return li, fi, nil
+}
+
+// true if both are the lock of the same run
+func (li lockInfo) same(other lockInfo) bool {
+	return li.Host == other.Host && li.PID == other.PID && li.Started.Equal(other.Started)
+}
+
+// why the lock is stale. Empty if it is not.
+func lockStale(li lockInfo, fi fs.FileInfo, now time.Time) string {
+	if age := now.Sub(fi.ModTime()); age > lockStaleAfter {
+		return fmt.Sprintf("not refreshed for %v", age.Round(time.Second))
+	}
+	if host, _ := os.Hostname(); len(li.Host) != 0 && li.Host == host && li.PID != os.Getpid() && !processRunning(li.PID) {
+		return "the process is no longer running"
+	}
+	return ""
+}
+
+func processRunning(pid int) bool {
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		return true //FindProcess fails for processes that are gone
+	}
+	err = proc.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM) //EPERM: running as another user
+}
+
+// takes the lock on the destination, breaking it if it is stale (or if --break-lock was given).
+// The lock is refreshed until Release is called. If it is taken over by another run in the meantime,
+// abort is called to stop the run.
+func (bkp *Backup) takeLock(bkps BackupFolder, label string, abort context.CancelCauseFunc) (*ztLock, error) {
+	host, _ := os.Hostname()
+	lock := &ztLock{bkps: bkps, label: FolderLabel(label), info: lockInfo{Host: host, PID: os.Getpid(), Started: time.Now()}}
+	data, _ := json.Marshal(lock.info)
+
+	for attempt := 0; attempt < 3; attempt++ {
+		err := bkps.CreateNewFile("", lockFileName, append(data, '\n'))
+		if err == nil {
+			if !lock.held() { //broken and taken over right away, or the create is not exclusive on this server
+				return nil, fmt.Errorf("%s is %w (the lock was taken over while it was being created)", lock.label, ErrLocked)
+			}
+			lock.stop = make(chan struct{})
+			lock.done = make(chan struct{})
+			go lock.heartbeat(&bkp.Log, abort)
+			return lock, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, fmt.Errorf("%w %s: %w", errCannotLock, lock.label, err)
+		}
+
+		held, fi, err := readLock(bkps, lockFileName)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue //released in the meantime
+		} else if err != nil {
+			return nil, fmt.Errorf("unable to read the lock on %s: %w", lock.label, err)
+		}
+		why := lockStale(held, fi, time.Now())
+		if bkp.BreakLock {
+			why = "--break-lock"
+		} else if len(why) == 0 {
+			return nil, fmt.Errorf("%s is %w (%v). Use --break-lock if that run is gone", lock.label, ErrLocked, held)
+		}
+		bkp.LogPrintf("\rBreaking the lock on %s held by %v (%s)\r\n", lock.label, held, why)
+		if err := lock.breakLock(held, fi, bkp.BreakLock); err != nil {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("%s is %w (the lock keeps coming back)", lock.label, ErrLocked)
+}
+
+// moves the lock file to a name only this run uses. Once moved, no other run can refresh, release or break
+// it, so it can be checked before it is deleted. Returns the lock moved and its new name.
+func (lock *ztLock) moveAside() (lockInfo, fs.FileInfo, string, error) {
+	aside := fmt.Sprintf("%s.%s-%d-%d", lockFileName, lock.info.Host, lock.info.PID, time.Now().UnixNano())
+	err := lock.bkps.Rename(prepareTargetName(lock.bkps, "", lockFileName), prepareTargetName(lock.bkps, "", aside))
+	if err != nil {
+		return lockInfo{}, nil, "", err
+	}
+	li, fi, err := readLock(lock.bkps, aside)
+	return li, fi, aside, err
+}
+
+// puts back a lock that was moved aside but is not the one expected. If yet another run has taken the
+// lock in between, the one moved aside is lost; its run notices it at its next heartbeat and stops.
+func (lock *ztLock) putBack(aside string) {
+	if data, err := lock.bkps.ReadWholeFile("", aside); err == nil {
+		lock.bkps.CreateNewFile("", lockFileName, data)
+	}
+	lock.bkps.DeleteFile("", aside)
+}
+
+// breaks the lock read as held (with fi). If it is no longer that lock (another run broke it and took it
+// over) or the run holding it has refreshed it since (unless anyway), it is left alone and the lock fails.
+func (lock *ztLock) breakLock(held lockInfo, fi fs.FileInfo, anyway bool) error {
+	moved, movedFi, aside, err := lock.moveAside()
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil //released or broken in the meantime. Try again.
+	} else if err != nil {
+		return fmt.Errorf("unable to break the lock on %s: %w", lock.label, err)
+	}
+	if !moved.same(held) || (!anyway && !movedFi.ModTime().Equal(fi.ModTime())) {
+		lock.putBack(aside)
+		return fmt.Errorf("%s is %w (%v took the lock while it was being broken)", lock.label, ErrLocked, moved)
+	}
+	if err := lock.bkps.DeleteFile("", aside); err != nil {
+		return fmt.Errorf("unable to break the lock on %s: %w", lock.label, err)
+	}
+	return nil
+}
+
+// refreshes the lock until it is released. If the lock was broken and taken by another run, the
+// destination is no longer ours: the run is stopped with abort and the other run's lock is left alone.
+func (lock *ztLock) heartbeat(ztl *ZtLog, abort context.CancelCauseFunc) {
+	defer close(lock.done)
+	ticker := time.NewTicker(lockHeartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-lock.stop:
+			return
+		case <-ticker.C:
+		}
+		if !lock.held() {
+			ztl.Printf("\r\nThe lock on %s was broken by another run. Stopping.\r\n", lock.label)
+			if abort != nil {
+				abort(fmt.Errorf("stopped: the lock on %s was taken over by another run", lock.label))
+			}
+			return
+		}
+		if err := lock.bkps.SetParams("", lockFileName, time.Now(), 0644); err != nil {
+			ztl.Printf("\r\nUnable to refresh the lock on %s: %v\r\n", lock.label, err)
+		}
+	}
+}
+
+// true if the lock file is still the one this run created
+func (lock *ztLock) held() bool {
+	li, _, err := readLock(lock.bkps, lockFileName)
+	return err == nil && li.same(lock.info)
+}
+
+// stops refreshing the lock and removes it (unless another run has taken it over). It is moved aside
+// first so that a lock taken over in the meantime is not removed.
+func (lock *ztLock) Release() {
+	if lock == nil {
+		return
+	}
+	close(lock.stop)
+	<-lock.done
+	moved, _, aside, err := lock.moveAside()
+	if err != nil {
+		return
+	}
+	if moved.same(lock.info) {
+		lock.bkps.DeleteFile("", aside)
+	} else {
+		lock.putBack(aside)
+	}
+}
@@ -0,0 +1,83 @@
+package ztbackup
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestLock(t *testing.T) {
+	dir := t.TempDir()
+	bkps := &LocalBackupFolder{szRootPath: dir}
+	lockPath := filepath.Join(dir, lockFileName)
+	var bkp Backup
+	bkp.Log.Dir = t.TempDir()
+
+	first, err := bkp.takeLock(bkps, dir, nil)
+	if err != nil {
+		t.Fatalf("first lock: %v", err)
+	}
+	if _, err := bkp.takeLock(bkps, dir, nil); !errors.Is(err, ErrLocked) {
+		t.Errorf("second lock: expected ErrLocked, got %v", err)
+	}
+
+	//not refreshed for too long
+	old := time.Now().Add(-2 * lockStaleAfter)
+	os.Chtimes(lockPath, old, old)
+	second, err := bkp.takeLock(bkps, dir, nil)
+	if err != nil {
+		t.Fatalf("stale lock not broken: %v", err)
+	}
+	first.Release() //taken over, so it is left alone
+	if _, err := os.Stat(lockPath); err != nil {
+		t.Errorf("the other run's lock was removed: %v", err)
+	}
+
+	bkp.BreakLock = true
+	third, err := bkp.takeLock(bkps, dir, nil)
+	if err != nil {
+		t.Fatalf("--break-lock: %v", err)
+	}
+	second.Release()
+	third.Release()
+	if _, err := os.Stat(lockPath); !os.IsNotExist(err) {
+		t.Errorf("lock not removed on release: %v", err)
+	}
+
+	//broken and taken over by another run between reading the lock and breaking it
+	bkp.BreakLock = false
+	stale, _ := bkp.takeLock(bkps, dir, nil)
+	os.Chtimes(lockPath, old, old)
+	held, fi, _ := readLock(bkps, lockFileName)
+	other, err := bkp.takeLock(bkps, dir, nil)
+	if err != nil {
+		t.Fatalf("stale lock not broken: %v", err)
+	}
+	if err := stale.breakLock(held, fi, false); !errors.Is(err, ErrLocked) {
+		t.Errorf("the other run's lock was broken: %v", err)
+	}
+	if !other.held() {
+		t.Errorf("the other run's lock was not put back")
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("%d files left in the destination. Expected the lock only", len(entries))
+	}
+	stale.Release()
+	other.Release()
+}
+
+// a folder where the lock can't be created at all (e.g. a read-only backup being restored from)
+func TestLockReadOnly(t *testing.T) {
+	bkps, err := InitializeFromFS(fstest.MapFS{"a.txt": {Data: []byte("a")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bkp Backup
+	if _, err := bkp.takeLock(bkps, "fstest", nil); !errors.Is(err, errCannotLock) || errors.Is(err, ErrLocked) {
+		t.Errorf("expected errCannotLock, got %v", err)
+	}
+}
@@ -0,0 +1,211 @@
+package ztbackup
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// The log goes to ~/.ztbackup/YYYYMM.log unless configured otherwise (--log-dir, --log-rotate, --log-keep
+// or log_dir, log_rotate, log_keep and log_per_job in jobs.toml). A new file is started every day, week or
+// month and only the newest Keep files are kept.
+const (
+	logRotateDaily   = "daily"
+	logRotateWeekly  = "weekly"
+	logRotateMonthly = "monthly"
+)
+
+type ZtLog struct {
+	Dir    string //~/.ztbackup if empty
+	Prefix string //e.g. the job name for per-job logs
+	Rotate string //daily, weekly or monthly (default)
+	Keep   int    //number of log files to keep. 0 to keep them all.
+
+	mu      sync.Mutex //the daemon logs from more than one goroutine
+	logFile *os.File
+	logName string
+	openErr error
+	console io.Writer //where Printf prints as well. See SetConsole.
+	shared  *ZtLog    //the log whose file is written to instead of our own. See UseFileOf.
+}
+
+// ~/.ztbackup. Holds the logs and other local state.
+func ZtFolder() (string, error) {
+	hdir, err := os.UserHomeDir()
+	if err != nil {
+		u, errUser := user.Current()
+		if errUser != nil {
+			return "", fmt.Errorf("unable to find the home folder: %w", err)
+		}
+		hdir = u.HomeDir
+	}
+	return fmt.Sprintf("%s%c%s", hdir, os.PathSeparator, ".ztbackup"), nil
+}
+
+// sets up the log location and rotation. Empty values leave the current setting alone.
+func (ztl *ZtLog) Configure(dir string, rotate string, szKeep string) error {
+	if len(dir) != 0 {
+		ztl.Dir = ExpandHome(dir)
+	}
+	switch rotate {
+	case "":
+	case logRotateDaily, logRotateWeekly, logRotateMonthly:
+		ztl.Rotate = rotate
+	default:
+		return fmt.Errorf("invalid log rotation '%s'. Expecting daily, weekly or monthly", rotate)
+	}
+	if len(szKeep) != 0 {
+		keep, err := strconv.Atoi(szKeep)
+		if err != nil || keep < 0 {
+			return fmt.Errorf("invalid number of log files to keep '%s'", szKeep)
+		}
+		ztl.Keep = keep
+	}
+	return nil
+}
+
+func (ztl *ZtLog) folder() (string, error) {
+	if len(ztl.Dir) != 0 {
+		return ztl.Dir, nil
+	}
+	return ZtFolder()
+}
+
+// the name of the log file for time t and a glob pattern matching the other files of the same log
+func (ztl *ZtLog) fileName(t time.Time) (string, string) {
+	var name, pattern string
+	switch ztl.Rotate {
+	case logRotateDaily:
+		name = t.Format("20060102")
+		pattern = "[0-9][0-9][0-9][0-9][0-9][0-9][0-9][0-9]"
+	case logRotateWeekly:
+		year, week := t.ISOWeek()
+		name = fmt.Sprintf("%04d-W%02d", year, week)
+		pattern = "[0-9][0-9][0-9][0-9]-W[0-9][0-9]"
+	default:
+		name = fmt.Sprintf("%04d%02d", t.Year(), t.Month())
+		pattern = "[0-9][0-9][0-9][0-9][0-9][0-9]"
+	}
+	if len(ztl.Prefix) != 0 {
+		name = ztl.Prefix + "-" + name
+		pattern = ztl.Prefix + "-" + pattern
+	}
+	return name + ".log", pattern + ".log"
+}
+
+func (ztl *ZtLog) OpenLogFile() {
+	logPath, err := ztl.folder()
+	if err != nil {
+		ztl.openErr = err
+		if ztl.console != nil { //mu is held
+			fmt.Fprintf(ztl.console, "\rUnable to open the log : %v\r\n", err)
+		}
+		return
+	}
+	fName, _ := ztl.fileName(time.Now())
+	fPath := fmt.Sprintf("%s%c%s", logPath, os.PathSeparator, fName)
+	os.MkdirAll(logPath, 0755)
+	//if it fails, openErr will be non-nil
+	ztl.logFile, ztl.openErr = os.OpenFile(fPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if ztl.openErr != nil {
+		if ztl.console != nil {
+			fmt.Fprintf(ztl.console, "\rError opening log %s : %v\r\n", fPath, ztl.openErr)
+		}
+		return
+	}
+	ztl.logName = fName
+	ztl.removeOldLogs()
+}
+
+// deletes all but the newest Keep files of this log
+func (ztl *ZtLog) removeOldLogs() {
+	if ztl.Keep <= 0 {
+		return
+	}
+	logPath, err := ztl.folder()
+	if err != nil {
+		return
+	}
+	_, pattern := ztl.fileName(time.Now())
+	files, err := filepath.Glob(filepath.Join(logPath, pattern))
+	if err != nil || len(files) <= ztl.Keep {
+		return
+	}
+	sort.Strings(files) //the names sort by date
+	for _, old := range files[:len(files)-ztl.Keep] {
+		os.Remove(old)
+	}
+}
+
+// the open log file. A new one is started when the period (day, week or month) changes.
+func (ztl *ZtLog) writer() io.Writer {
+	if ztl.logFile != nil {
+		if fName, _ := ztl.fileName(time.Now()); fName != ztl.logName {
+			ztl.CloseLogFile()
+		}
+	}
+	if ztl.logFile == nil && ztl.openErr == nil {
+		ztl.OpenLogFile()
+	}
+	if ztl.logFile == nil {
+		return nil //already reported
+	}
+	return ztl.logFile
+}
+
+// writes to the file of other instead of opening one. e.g. the jobs of a run share the log of the run.
+// nil to use our own file again.
+func (ztl *ZtLog) UseFileOf(other *ZtLog) {
+	ztl.mu.Lock()
+	defer ztl.mu.Unlock()
+	ztl.shared = other
+}
+
+// where Printf prints, besides the log file. Nothing is printed if nil.
+func (ztl *ZtLog) SetConsole(console io.Writer) {
+	ztl.mu.Lock()
+	defer ztl.mu.Unlock()
+	ztl.console = console
+}
+
+func (ztl *ZtLog) Printf(format string, a ...any) {
+
+	outs := fmt.Sprintf(format, a...)
+
+	ztl.mu.Lock()
+	if ztl.console != nil {
+		fmt.Fprint(ztl.console, outs)
+	}
+	ztl.mu.Unlock()
+	ztl.writeFile(outs)
+}
+
+// writes a timestamped line to the log file only
+func (ztl *ZtLog) Audit(line string) {
+	ztl.writeFile(fmt.Sprintf("%s %s\r\n", time.Now().Format("2006-01-02 15:04:05"), line))
+}
+
+func (ztl *ZtLog) writeFile(outs string) {
+	ztl.mu.Lock()
+	defer ztl.mu.Unlock()
+	if ztl.shared != nil {
+		ztl.shared.writeFile(outs)
+		return
+	}
+	if w := ztl.writer(); w != nil {
+		fmt.Fprint(w, outs)
+	}
+}
+
+func (ztl *ZtLog) CloseLogFile() {
+	if ztl.logFile != nil {
+		ztl.logFile.Close()
+		ztl.logFile = nil
+	}
+}
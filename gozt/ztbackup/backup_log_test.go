@@ -0,0 +1,75 @@
+package ztbackup
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestLogFileName(t *testing.T) {
+	day := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC) //in week 1 of 2026
+	tests := []struct {
+		rotate, prefix string
+		want           string
+	}{
+		{"", "", "202601.log"},
+		{logRotateDaily, "", "20260101.log"},
+		{logRotateWeekly, "", "2026-W01.log"},
+		{logRotateMonthly, "pictures", "pictures-202601.log"},
+	}
+	for _, tt := range tests {
+		ztl := ZtLog{Rotate: tt.rotate, Prefix: tt.prefix}
+		name, pattern := ztl.fileName(day)
+		if name != tt.want {
+			t.Errorf("%s %s: %s. Expected %s", tt.rotate, tt.prefix, name, tt.want)
+		}
+		if ok, _ := filepath.Match(pattern, name); !ok {
+			t.Errorf("%s does not match %s", name, pattern)
+		}
+	}
+}
+
+// only the newest Keep files of the log are kept. The other logs in the folder are left alone.
+func TestLogKeep(t *testing.T) {
+	dir := t.TempDir()
+	old := []string{"20200101.log", "20200102.log", "20200103.log", "pictures-20200101.log", "202001.log", "notes.txt"}
+	for _, name := range old {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ztl := ZtLog{}
+	if err := ztl.Configure(dir, logRotateDaily, "2"); err != nil {
+		t.Fatal(err)
+	}
+	ztl.Printf("started\r\n")
+	ztl.CloseLogFile()
+
+	today, _ := ztl.fileName(time.Now())
+	var names []string
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	expected := []string{"20200103.log", "202001.log", today, "notes.txt", "pictures-20200101.log"}
+	sort.Strings(expected)
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("%v left. Expected %v", names, expected)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, today)); string(data) != "started\r\n" {
+		t.Errorf("%s: %q", today, data)
+	}
+}
+
+func TestLogConfigureInvalid(t *testing.T) {
+	var ztl ZtLog
+	if err := ztl.Configure("", "hourly", ""); err == nil {
+		t.Errorf("accepted hourly rotation")
+	}
+	if err := ztl.Configure("", "", "-1"); err == nil {
+		t.Errorf("accepted keeping -1 files")
+	}
+}
@@ -0,0 +1,212 @@
+package ztbackup
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// With --prescan, the source is scanned before the backup to count the files (and bytes) that need to be
+// copied. An overall progress line (files and bytes done, throughput and ETA) is then shown while copying.
+// When the output is not a terminal, a plain line is printed every progressPlainInterval instead.
+const progressTTYInterval = 500 * time.Millisecond
+const progressPlainInterval = 10 * time.Second
+
+type ztProgress struct {
+	totalFiles, totalBytes int64
+	doneFiles, doneBytes   int64
+	started                time.Time
+	lastShown              time.Time
+	lastBytes              int64   //doneBytes when last shown
+	rate                   float64 //bytes per second, smoothed
+}
+
+// true if w is a terminal (and not a file or a pipe)
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	return ok && term.IsTerminal(int(f.Fd()))
+}
+
+// e.g. 1.5 GB. 1024 based, same as the suffixes accepted by --bwlimit
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit && exp < 3; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGT"[exp])
+}
+
+// counts the files (and bytes) under folderPath that will be copied to at least one of the destinations.
+// Files where the destination is newer are not counted, since they need a decision.
+func (bkp *Backup) prescan(folderPath string) {
+	var zte ztExclude
+	zte.LoadFile(*bkp.srcBack, folderPath)
+	zte.exGlobalList = bkp.Excludes
+
+	fmts, err := ReadDir(*bkp.srcBack, folderPath)
+	if err != nil {
+		return
+	}
+	var joins []*ztJoin
+	for _, dest := range bkp.destinations() {
+		fmtd, errDst := ReadDir(*dest.dstBack, folderPath)
+		joins = append(joins, joinListings(fmts, *dest.dstBack, folderPath, fmtd, errDst))
+		if dest.space != nil && errDst == nil {
+			dest.space.projected -= dest.projectedDeletes(folderPath, fmtd, joinListings(fmtd, *bkp.srcBack, folderPath, fmts, nil), zte)
+		}
+	}
+	for i, ctr := range fmts {
+		if len(folderPath) == 0 && isDestinationMeta(ctr.Name()) {
+			continue //not backed up (see backupFolder)
+		}
+		if ctr.Mode().IsRegular() {
+			counted := false
+			for d, dest := range bkp.destinations() {
+				if !dest.needsCopy(folderPath, ctr, zte, joins[d], i) {
+					continue
+				}
+				if dest.space != nil {
+					dest.space.projected += ctr.Size()
+					if fDst, err := joins[d].find(i, ctr.Name()); err == nil && !dest.VersionFlag {
+						dest.space.projected -= fDst.Size() //overwritten
+					}
+				}
+				if !counted {
+					bkp.progress.totalFiles++
+					bkp.progress.totalBytes += ctr.Size()
+					counted = true
+				}
+			}
+		} else if ctr.IsDir() && bkp.RecursiveFlag && !zte.IsExcluded(ctr.Name()) {
+			bkp.prescan(bkp.prepareName(folderPath, ctr.Name()))
+		}
+	}
+}
+
+// the bytes of the destination folder (listed as fmtd) that will be deleted without asking, since they are
+// missing in the source (or are OS specific). Nothing is freed with versions, except OS specific files.
+func (bkp *Backup) projectedDeletes(folderPath string, fmtd []fs.FileInfo, srcJoin *ztJoin, zte ztExclude) int64 {
+	var size int64
+	for i, ctr := range fmtd {
+		if len(folderPath) == 0 && isDestinationMeta(ctr.Name()) {
+			continue
+		}
+		if ctr.Mode().IsRegular() && zte.IsOsSpecific(ctr.Name()) {
+			size += ctr.Size()
+			continue
+		}
+		if bkp.VersionFlag {
+			continue
+		}
+		if _, err := srcJoin.find(i, ctr.Name()); !errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if ctr.Mode().IsRegular() && bkp.FileOption == OptDelete {
+			size += ctr.Size()
+		} else if ctr.IsDir() && bkp.RecursiveFlag && bkp.FolderOption == OptDelete {
+			_, sz := bkp.countFolder(*bkp.dstBack, bkp.prepareName(folderPath, ctr.Name()))
+			size += sz
+		}
+	}
+	return size
+}
+
+// same as forwardStatus, without asking anything
+func (bkp *Backup) needsCopy(path string, fSrc fs.FileInfo, zte ztExclude, dstJoin *ztJoin, i int) bool {
+	if zte.IsExcluded(fSrc.Name()) {
+		return false
+	}
+	fDst, err := dstJoin.find(i, fSrc.Name())
+	if errors.Is(err, fs.ErrNotExist) {
+		return true
+	}
+	if err != nil {
+		return false
+	}
+	return compareFiles(fSrc, fDst) == copyForward
+}
+
+func (bkp *Backup) startProgress() {
+	bkp.Printf("\rScanning the source...")
+	bkp.progress = &ztProgress{}
+	bkp.prescan("")
+	bkp.progress.started = time.Now()
+	bkp.progress.lastShown = bkp.progress.started
+	bkp.LogPrintf("\r%d file(s) (%s) to copy\r\n", bkp.progress.totalFiles, FormatBytes(bkp.progress.totalBytes))
+}
+
+// e.g. 12/340 files, 120.0 MB/1.2 GB, 5.1 MB/s, ETA 3m20s
+func (pr *ztProgress) String() string {
+	line := fmt.Sprintf("%d/%d files, %s/%s", pr.doneFiles, pr.totalFiles, FormatBytes(pr.doneBytes), FormatBytes(pr.totalBytes))
+	if pr.rate > 0 {
+		line += fmt.Sprintf(", %s/s", FormatBytes(int64(pr.rate)))
+		if pr.totalBytes > pr.doneBytes {
+			eta := time.Duration(float64(pr.totalBytes-pr.doneBytes) / pr.rate * float64(time.Second))
+			line += ", ETA " + eta.Round(time.Second).String()
+		}
+	}
+	return line
+}
+
+// updates the smoothed throughput. Returns false if it is too early to show the progress again.
+func (pr *ztProgress) tick(interval time.Duration) bool {
+	elapsed := time.Since(pr.lastShown)
+	if elapsed < interval {
+		return false
+	}
+	current := float64(pr.doneBytes-pr.lastBytes) / elapsed.Seconds()
+	if pr.rate == 0 {
+		pr.rate = current
+	} else {
+		pr.rate = 0.7*pr.rate + 0.3*current
+	}
+	pr.lastShown = time.Now()
+	pr.lastBytes = pr.doneBytes
+	return true
+}
+
+// shows the progress of the file being copied (percent is -1 when finished) along with the overall progress (if any)
+func (bkp *Backup) showProgress(strAction string, percent int) {
+	if bkp.Display != nil {
+		overall := ""
+		if bkp.progress != nil {
+			bkp.progress.tick(progressTTYInterval)
+			overall = bkp.progress.String()
+		}
+		bkp.Display.Transfer(strAction, percent, overall)
+		return
+	}
+	if !bkp.isTTY {
+		if percent < 0 {
+			bkp.Printf("%sdone\r\n", strAction)
+		}
+		if bkp.progress != nil && bkp.progress.tick(progressPlainInterval) {
+			bkp.Printf("Progress: %s\r\n", bkp.progress)
+		}
+		return
+	}
+	line := strAction
+	if percent < 0 {
+		line += "done"
+	} else {
+		line += fmt.Sprintf("%d%%", percent)
+	}
+	if bkp.progress != nil {
+		bkp.progress.tick(progressTTYInterval)
+		line += "   [" + bkp.progress.String() + "]   "
+	}
+	if percent < 0 {
+		line += "\r\n"
+	}
+	bkp.Printf("%s", line)
+}
@@ -0,0 +1,58 @@
+package ztbackup
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// the files to copy to any of the destinations are counted once. Excluded files, files already backed up and
+// files newer in the destination are not counted.
+func TestPrescanTotals(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	src, dst1, dst2 := t.TempDir(), t.TempDir(), t.TempDir()
+	old := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	for _, file := range []struct {
+		dirs []string
+		name string
+		size int
+		mod  time.Time
+	}{
+		{[]string{src}, "new", 10, old},
+		{[]string{src, dst1, dst2}, "same", 20, old},
+		{[]string{src, dst1}, "partial", 30, old},
+		{[]string{src}, filepath.Join("sub", "deep"), 40, old},
+		{[]string{src}, "skip.tmp", 50, old},
+		{[]string{src}, catalogIdFile, 60, old}, //the source is the destination of another backup
+		{[]string{src}, lockFileName, 60, old},
+		{[]string{src}, filepath.Join(versionFolder, "new~20260901T000000Z"), 60, old},
+		{[]string{src}, "newer", 70, old},
+		{[]string{dst1, dst2}, "newer", 80, old.Add(time.Hour)},
+	} {
+		for _, dir := range file.dirs {
+			fPath := filepath.Join(dir, file.name)
+			os.MkdirAll(filepath.Dir(fPath), 0o755)
+			if err := os.WriteFile(fPath, make([]byte, file.size), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			os.Chtimes(fPath, file.mod, file.mod)
+		}
+	}
+
+	bkp := Backup{Options: Options{RecursiveFlag: true, PrescanFlag: true, FileOption: OptLeave, Excludes: []string{"*.tmp"}}}
+	if err := bkp.Run(context.Background(), src, []string{dst1, dst2}, FolderOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	pr := bkp.progress
+	if pr.totalFiles != 3 || pr.totalBytes != 80 {
+		t.Errorf("%d files (%d bytes) to copy. Expected 3 (80 bytes)", pr.totalFiles, pr.totalBytes)
+	}
+	if pr.doneFiles != pr.totalFiles || pr.doneBytes != pr.totalBytes {
+		t.Errorf("%d files (%d bytes) copied of %d (%d bytes)", pr.doneFiles, pr.doneBytes, pr.totalFiles, pr.totalBytes)
+	}
+	if _, err := os.Stat(filepath.Join(dst2, versionFolder, "new~20260901T000000Z")); err == nil {
+		t.Errorf("the versions of the source were backed up")
+	}
+}
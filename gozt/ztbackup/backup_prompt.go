@@ -0,0 +1,89 @@
+package ztbackup
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// The questions (file missing in source, destination newer than source) are asked through a Prompter.
+// On a terminal, the CLI asks for a key press with a countdown. Without one (cron, systemd), the answers
+// are read from the piped stdin or an answers file (LinePrompter), one per line, in the order the questions
+// are asked. When there is no (more) input, the non-interactive policy applies (PolicyPrompter).
+type Prompter interface {
+	// returns the answer (one of answers) and whether it was the default
+	Ask(ctx context.Context, query string, answers string, defaultAnswer rune) (rune, bool)
+}
+
+// a Prompter that can also decide on all the items collected with ReviewFlag at once (e.g. by listing them).
+// Other prompters are asked about every item, one at a time.
+type ReviewPrompter interface {
+	Prompter
+	// sets the Action of the items. Returns false to leave all of them alone and do nothing (e.g. the run was cancelled).
+	Review(ctx context.Context, items []*ReviewItem) bool
+}
+
+// answers with the policy if it is one of the possible answers, the default otherwise.
+type PolicyPrompter struct {
+	Policy rune      //0 to take the default
+	Out    io.Writer //where the question and the answer are printed. Not printed if nil.
+}
+
+func (pp PolicyPrompter) Ask(ctx context.Context, query string, answers string, defaultAnswer rune) (rune, bool) {
+	ans := defaultAnswer
+	if pp.Policy != 0 && strings.ContainsRune(answers, pp.Policy) {
+		ans = pp.Policy
+	}
+	if pp.Out != nil {
+		fmt.Fprintf(pp.Out, "%s\r\n[%c] (non-interactive)\r\n", query, ans)
+	}
+	return ans, true
+}
+
+// reads the answers from a file or a pipe, one per line. Empty lines and lines starting with # are skipped.
+type LinePrompter struct {
+	in       *bufio.Scanner
+	name     string //for the messages
+	nLine    int
+	fallback PolicyPrompter
+}
+
+// name is used in the messages (e.g. the file name). fallback answers once there are no more lines.
+func NewLinePrompter(in io.Reader, name string, fallback PolicyPrompter) *LinePrompter {
+	return &LinePrompter{in: bufio.NewScanner(in), name: name, fallback: fallback}
+}
+
+func (lp *LinePrompter) Ask(ctx context.Context, query string, answers string, defaultAnswer rune) (rune, bool) {
+	for lp.in != nil && lp.in.Scan() {
+		lp.nLine++
+		line := strings.TrimSpace(lp.in.Text())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		ans := unicode.ToLower([]rune(line)[0])
+		if !strings.ContainsRune(answers, ans) {
+			lp.printf("\rInvalid answer '%s' in %s line %d. Expecting one of '%s'\r\n", line, lp.name, lp.nLine, answers)
+			return lp.fallback.Ask(ctx, query, answers, defaultAnswer)
+		}
+		lp.printf("%s\r\n[%c] (from %s)\r\n", query, ans, lp.name)
+		return ans, false
+	}
+	lp.in = nil //no more answers
+	return lp.fallback.Ask(ctx, query, answers, defaultAnswer)
+}
+
+func (lp *LinePrompter) printf(format string, a ...any) {
+	if lp.fallback.Out != nil {
+		fmt.Fprintf(lp.fallback.Out, format, a...)
+	}
+}
+
+func (bkp *Backup) prompter() Prompter {
+	if bkp.Prompter != nil {
+		return bkp.Prompter
+	}
+	return PolicyPrompter{Out: bkp.console()}
+}
@@ -0,0 +1,77 @@
+package ztbackup
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"golang.org/x/text/message"
+)
+
+// answers from a list, recording the questions
+type scriptedPrompter struct {
+	answers []rune
+	asked   []string
+}
+
+func (sp *scriptedPrompter) Ask(ctx context.Context, query string, answers string, defaultAnswer rune) (rune, bool) {
+	sp.asked = append(sp.asked, query)
+	if len(sp.answers) == 0 {
+		return defaultAnswer, true
+	}
+	ans := sp.answers[0]
+	sp.answers = sp.answers[1:]
+	return ans, false
+}
+
+func TestQuestions(t *testing.T) {
+	info := func(mod time.Time, data string) fs.FileInfo {
+		fi, _ := fstest.MapFS{"f.txt": &fstest.MapFile{ModTime: mod, Data: []byte(data)}}.Stat("f.txt")
+		return fi
+	}
+	ctx := context.Background()
+	now := time.Now()
+	sp := &scriptedPrompter{answers: []rune{'d', 'r', 'b'}}
+	bkp := Backup{Prompter: sp, statPrinter: message.NewPrinter(message.MatchLanguage("en"))}
+	bkp.Log.Dir = t.TempDir() //the answers are logged
+
+	if got := bkp.fileMissingQuestion(ctx, "", info(now, "x")); got != copyDeleteDestination {
+		t.Errorf("missing, answer d: got %v", got)
+	}
+	if got := bkp.fileMissingQuestion(ctx, "", info(now, "x")); got != copyBackward {
+		t.Errorf("missing, answer r: got %v", got)
+	}
+	if got, _ := bkp.copyCheck(ctx, "", info(now, "x"), info(now.Add(time.Hour), "x")); got != copyForward {
+		t.Errorf("destination newer, answer b: got %v", got)
+	}
+	if got, _ := bkp.copyCheck(ctx, "", info(now, "x"), info(now.Add(time.Hour), "x")); got != copyLeave {
+		t.Errorf("destination newer, no more answers: got %v", got)
+	}
+	if len(sp.asked) != 4 {
+		t.Errorf("expected 4 questions, got %d", len(sp.asked))
+	}
+
+	bkp.FileOption = OptLeave
+	if got := bkp.fileMissingQuestion(ctx, "", info(now, "x")); got != copyLeave || len(sp.asked) != 4 {
+		t.Errorf("-l should leave without asking")
+	}
+}
+
+func TestLinePrompter(t *testing.T) {
+	ctx := context.Background()
+	lp := NewLinePrompter(strings.NewReader("# answers\nd\n\nx\n"), "test", PolicyPrompter{Policy: 'b', Out: io.Discard})
+
+	if ans, defaulted := lp.Ask(ctx, "?", "drl", 'l'); ans != 'd' || defaulted {
+		t.Errorf("first answer: got %c %v", ans, defaulted)
+	}
+	if ans, defaulted := lp.Ask(ctx, "?", "drl", 'l'); ans != 'l' || !defaulted {
+		t.Errorf("invalid answer should take the default: got %c %v", ans, defaulted)
+	}
+	if ans, defaulted := lp.Ask(ctx, "?", "brl", 'l'); ans != 'b' || !defaulted {
+		t.Errorf("no more answers should apply the policy: got %c %v", ans, defaulted)
+	}
+}
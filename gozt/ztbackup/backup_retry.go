@@ -0,0 +1,145 @@
+package ztbackup
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"net"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/hirochachacha/go-smb2"
+	"github.com/pkg/sftp"
+)
+
+// A remote folder (SMB or SFTP) whose connection is lost (e.g. a Wi-Fi blip during a long backup) dials
+// again with the original URL and credentials and retries the operation that failed. The attempts are
+// spaced out exponentially, from retryFirstDelay up to retryMaxDelay, retryAttempts times in all.
+// A file being copied when the connection was lost is copied again from the start (see transferFileToAll).
+const retryAttempts = 7
+const retryFirstDelay = time.Second
+const retryMaxDelay = 30 * time.Second
+
+const fileRestarts = 3 //times a file is copied again after its connection was lost
+
+const connectTimeout = 30 * time.Second
+const keepAliveInterval = 15 * time.Second //and how long to wait for the answer
+
+// true if err means that the connection to the server is gone, rather than a problem with the file. A plain
+// EOF is not one (it may be a file that got shorter): a lost SMB or SFTP connection is reported by the transport.
+func isConnectionError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var netErr net.Error
+	var smbErr *smb2.TransportError
+	switch {
+	case errors.Is(err, sftp.ErrSSHFxConnectionLost), errors.Is(err, sftp.ErrSSHFxNoConnection):
+	case errors.Is(err, net.ErrClosed):
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.ECONNABORTED), errors.Is(err, syscall.EPIPE):
+	case errors.As(err, &netErr), errors.As(err, &smbErr):
+	default:
+		return false
+	}
+	return true
+}
+
+func retryDelay(attempt int) time.Duration {
+	delay := retryFirstDelay << attempt
+	if delay > retryMaxDelay || delay <= 0 {
+		return retryMaxDelay
+	}
+	return delay
+}
+
+// reconnects a remote folder. The folder's connection is only replaced while mu is held, so that
+// operations from other goroutines (e.g. the heartbeat of the run lock) see either the old or the new one.
+type ztReconnect struct {
+	label   string          //e.g. sftp://user@host/path
+	connect func() error    //dials again. Called with mu held.
+	ctx     context.Context //of the run. The waits before dialing again stop when it is done. Never done if nil.
+	log     *ZtLog          //where the lost connections are logged. Not logged if nil.
+
+	mu      sync.RWMutex
+	gen     int //incremented with every new connection
+	retries atomic.Int64
+	down    atomic.Bool //all the attempts failed. Only one more is made for each operation until the server is back.
+}
+
+// runs op, reconnecting and retrying it for as long as it fails because the connection was lost. Stops
+// waiting (and returns the cause) when the context of the run is done.
+func (rc *ztReconnect) do(op func() error) error {
+	ctx := rc.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	for attempt := 0; ; attempt++ {
+		rc.mu.RLock()
+		gen := rc.gen
+		rc.mu.RUnlock()
+
+		err := op()
+		if !isConnectionError(err) {
+			return err
+		}
+		if attempt == retryAttempts || (attempt == 1 && rc.down.Load()) {
+			rc.down.Store(true)
+			return err
+		}
+		rc.retries.Add(1)
+		delay := retryDelay(attempt)
+		rc.logf("\rConnection to %s lost (%v). Reconnecting in %v (attempt %d of %d)\r\n", rc.label, err, delay, attempt+1, retryAttempts)
+		select {
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		case <-time.After(delay):
+		}
+		if err := rc.reconnect(gen); err != nil && !isConnectionError(err) {
+			return err //e.g. the credentials are no longer accepted
+		}
+	}
+}
+
+// runs create, which creates a file with data and fails with fs.ErrExist if it is already there, like do.
+// If the connection was lost after the file was created, the retry finds it: it is the one created (and
+// create succeeded) only if read finds data in it, e.g. the owner of a lock. Otherwise it belongs to another
+// run and the error is returned.
+func (rc *ztReconnect) doCreate(data []byte, create func() error, read func() ([]byte, error)) error {
+	attempt := 0
+	return rc.do(func() error {
+		attempt++
+		err := create()
+		if attempt > 1 && errors.Is(err, fs.ErrExist) {
+			if existing, errRead := read(); errRead == nil && bytes.Equal(existing, data) {
+				return nil
+			}
+		}
+		return err
+	})
+}
+
+// dials again unless another goroutine already did since connection gen was in use
+func (rc *ztReconnect) reconnect(gen int) error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.gen != gen {
+		return nil
+	}
+	if err := rc.connect(); err != nil {
+		rc.logf("\rUnable to reconnect to %s : %v\r\n", rc.label, err)
+		return err
+	}
+	rc.gen++
+	rc.down.Store(false)
+	rc.logf("\rReconnected to %s\r\n", rc.label)
+	return nil
+}
+
+func (rc *ztReconnect) logf(format string, a ...any) {
+	if rc.log != nil {
+		rc.log.Printf(format, a...)
+	}
+}
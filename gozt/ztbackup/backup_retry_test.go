@@ -0,0 +1,86 @@
+package ztbackup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hirochachacha/go-smb2"
+	"github.com/pkg/sftp"
+)
+
+func TestIsConnectionError(t *testing.T) {
+	lost := []error{
+		sftp.ErrSSHFxConnectionLost,
+		&smb2.TransportError{Err: fmt.Errorf("broken pipe")},
+		fmt.Errorf("reading a.txt: %w", &smb2.TransportError{Err: io.ErrUnexpectedEOF}),
+		&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED},
+		&fs.PathError{Op: "open", Path: "a", Err: syscall.ECONNRESET},
+	}
+	for _, err := range lost {
+		if !isConnectionError(err) {
+			t.Errorf("%v should be a connection error", err)
+		}
+	}
+	//a short file is not a lost connection. Only when the transport says so.
+	for _, err := range []error{nil, fs.ErrNotExist, &fs.PathError{Op: "open", Path: "a", Err: fs.ErrPermission}, io.EOF,
+		fmt.Errorf("reading a.txt: %w", io.ErrUnexpectedEOF)} {
+		if isConnectionError(err) {
+			t.Errorf("%v should not be a connection error", err)
+		}
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	if retryDelay(0) != retryFirstDelay || retryDelay(2) != 4*retryFirstDelay {
+		t.Errorf("unexpected delays %v %v", retryDelay(0), retryDelay(2))
+	}
+	if retryDelay(retryAttempts) != retryMaxDelay || retryDelay(100) != retryMaxDelay {
+		t.Errorf("delay not capped: %v", retryDelay(100))
+	}
+}
+
+func TestRetryCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	cancel(ErrCancelled)
+	rc := &ztReconnect{label: "sftp://nas", connect: func() error { return nil }, ctx: ctx}
+	started := time.Now()
+	err := rc.do(func() error { return sftp.ErrSSHFxConnectionLost })
+	if !errors.Is(err, ErrCancelled) || time.Since(started) >= retryFirstDelay {
+		t.Errorf("%v after %v. Expected to be cancelled right away", err, time.Since(started))
+	}
+}
+
+func TestRetryCreate(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		existing string //in the file found by the retry
+		created  bool
+	}{
+		{"created before the connection was lost", "lock", true},
+		{"created by another run", "other", false},
+	} {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			rc := &ztReconnect{label: "sftp://nas", connect: func() error { return nil }}
+			attempts := 0
+			err := rc.doCreate([]byte("lock"), func() error {
+				attempts++
+				if attempts == 1 {
+					return sftp.ErrSSHFxConnectionLost //after creating the file
+				}
+				return &fs.PathError{Op: "create", Path: ".ztlock", Err: fs.ErrExist}
+			}, func() ([]byte, error) { return []byte(test.existing), nil })
+			if (err == nil) != test.created || (err != nil && !errors.Is(err, fs.ErrExist)) {
+				t.Errorf("%v after %d attempts", err, attempts)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package ztbackup
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+)
+
+// With ReviewFlag (--review), the questions (-a, -b) are not asked while backing up. The files and folders that
+// need a decision are collected instead and, at the end of the run, given to the Prompter all at once if it is a
+// ReviewPrompter (which lists them to be marked for delete, restore, backup or leave in bulk) or one at a time
+// otherwise. Nothing is done before all the decisions are taken.
+type ReviewItem struct {
+	Info    fs.FileInfo //the destination file or folder
+	SrcInfo fs.FileInfo //the source file if the destination is newer. nil if the source is missing.
+	Action  rune        //d, r, b or l. l (leave) unless changed.
+
+	dest *Backup
+	path string //folder
+}
+
+type ztReview struct {
+	items []*ReviewItem
+}
+
+func (rv *ztReview) add(dest *Backup, path string, fDst fs.FileInfo, fSrc fs.FileInfo) {
+	rv.items = append(rv.items, &ReviewItem{dest: dest, path: path, Info: fDst, SrcInfo: fSrc, Action: 'l'})
+}
+
+// relative to the destination
+func (ri *ReviewItem) Path() string {
+	return ri.dest.prepareName(ri.path, ri.Info.Name())
+}
+
+func (ri *ReviewItem) Destination() string {
+	return FolderLabel(ri.dest.dstLabel)
+}
+
+func (ri *ReviewItem) Issue() string {
+	switch {
+	case ri.SrcInfo != nil:
+		return "destination newer"
+	case ri.Info.IsDir():
+		return "folder missing"
+	}
+	return "source missing"
+}
+
+// the possible actions
+func (ri *ReviewItem) Answers() string {
+	if ri.SrcInfo != nil {
+		return "brl"
+	}
+	return "drl"
+}
+
+var reviewActionNames = map[rune]string{'d': "delete", 'r': "restore", 'b': "backup", 'l': "leave"}
+
+// e.g. "delete" for 'd'
+func ReviewActionName(action rune) string {
+	return reviewActionNames[action]
+}
+
+// lets the prompter decide on the collected items, then applies the decisions. Nothing is done if the run is cancelled.
+func (bkp *Backup) reviewPending(ctx context.Context) {
+	rv := bkp.review
+	if len(rv.items) == 0 {
+		return
+	}
+	sort.SliceStable(rv.items, func(i, j int) bool { return rv.items[i].Path() < rv.items[j].Path() })
+
+	if rp, ok := bkp.prompter().(ReviewPrompter); ok {
+		if !rp.Review(ctx, rv.items) {
+			return
+		}
+	} else {
+		//one item at a time
+		for _, ri := range rv.items {
+			query := fmt.Sprintf("%s: %s. Do you want to %s?", ri.Path(), ri.Issue(), strings.Join(ri.actionList(), ", "))
+			ri.Action, _ = bkp.prompter().Ask(ctx, query, ri.Answers(), 'l')
+		}
+	}
+	bkp.applyReview(ctx, rv)
+}
+
+func (ri *ReviewItem) actionList() []string {
+	var list []string
+	for _, ans := range ri.Answers() {
+		list = append(list, fmt.Sprintf("(%c)%s", ans, reviewActionNames[ans][1:]))
+	}
+	return list
+}
+
+func (bkp *Backup) applyReview(ctx context.Context, rv *ztReview) {
+	for _, ri := range rv.items {
+		if bkp.stopped(ctx) {
+			return
+		}
+		dest := ri.dest
+		relPath := ri.Path()
+		reason := ri.Issue()
+		dest.emit(Event{Event: EvPrompt, Path: relPath, Question: "review: " + reason, Answer: string(ri.Action)})
+
+		switch {
+		case ri.Info.IsDir():
+			switch ri.Action {
+			case 'd':
+				dest.recurseDelete(*dest.dstBack, relPath)
+			case 'r':
+				dest.recurseRestore(ctx, relPath, ri.Info)
+			default:
+				dest.emit(Event{Event: EvSkipped, Path: relPath, Reason: "source folder missing"})
+			}
+		case ri.SrcInfo == nil:
+			switch ri.Action {
+			case 'd':
+				dest.deleteFile(ri.path, ri.Info, dest.VersionFlag, reason)
+			case 'r':
+				dest.copyFile(ctx, ri.path, ri.Info, false, reason)
+			default:
+				dest.skipFile(ri.path, ri.Info, false, reason)
+			}
+		default:
+			switch ri.Action {
+			case 'b':
+				if !dest.checkSpace(ri.path, ri.SrcInfo, ri.Info) {
+					continue
+				}
+				if dest.VersionFlag {
+					if err := dest.archiveVersion(*dest.dstBack, ri.path, ri.Info); err != nil {
+						dest.reportError(relPath, "Error archiving old version of", err)
+						continue
+					}
+				}
+				errs := bkp.copyFileToAll(ctx, ri.path, ri.SrcInfo, []*Backup{dest}, []string{reason})
+				if errs[0] == nil && dest.catalog != nil {
+					//listed (and catalogued) before it was replaced
+					dest.catalog.addFile(relPath, ri.SrcInfo.Size(), ri.SrcInfo.ModTime(), catalogCurrent)
+				}
+			case 'r':
+				dest.copyFile(ctx, ri.path, ri.Info, false, reason)
+			default:
+				dest.skipFile(ri.path, ri.SrcInfo, true, reason)
+			}
+		}
+	}
+}
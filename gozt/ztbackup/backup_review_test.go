@@ -0,0 +1,91 @@
+package ztbackup
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// marks every item with the action at the start of its name
+type nameReviewer struct {
+	PolicyPrompter
+}
+
+func (nameReviewer) Review(ctx context.Context, items []*ReviewItem) bool {
+	for _, ri := range items {
+		ri.Action = rune(ri.Info.Name()[0])
+	}
+	return true
+}
+
+func TestReviewActions(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	src, dst := t.TempDir(), t.TempDir()
+	older, newer := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 9, 2, 0, 0, 0, 0, time.UTC)
+	write := func(dir string, name string, data string, mod time.Time) {
+		t.Helper()
+		fPath := filepath.Join(dir, name)
+		if err := os.WriteFile(fPath, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(fPath, mod, mod)
+	}
+	//source missing: d, r, l. Destination newer: b, r, l.
+	for _, name := range []string{"d-missing", "r-missing", "l-missing"} {
+		write(dst, name, "dst", newer)
+	}
+	for _, name := range []string{"b-newer", "r-newer", "l-newer"} {
+		write(src, name, "source", older)
+		write(dst, name, "dst", newer)
+	}
+
+	bkp := Backup{Options: Options{FileOption: OptAsk, ReviewFlag: true, VersionFlag: true}, Prompter: nameReviewer{}}
+	if err := bkp.Run(context.Background(), src, []string{dst}, FolderOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]struct{ src, dst string }{
+		"d-missing": {"", ""},
+		"r-missing": {"dst", "dst"},
+		"l-missing": {"", "dst"},
+		"b-newer":   {"source", "source"},
+		"r-newer":   {"dst", "dst"},
+		"l-newer":   {"source", "dst"},
+	}
+	for name, exp := range expected {
+		for _, side := range []struct{ dir, data string }{{src, exp.src}, {dst, exp.dst}} {
+			data, err := os.ReadFile(filepath.Join(side.dir, name))
+			if (err != nil) != (len(side.data) == 0) || string(data) != side.data {
+				t.Errorf("%s in %s: %q, %v. Expected %q", name, side.dir, data, err, side.data)
+			}
+		}
+	}
+
+	_, entries, err := LoadCatalogFile(CatalogFiles()[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	current := make(map[string]int64)
+	nVersions := 0
+	for _, ce := range entries {
+		if ce.Version == catalogCurrent {
+			if _, dup := current[ce.Path]; dup {
+				t.Errorf("%s is listed twice", ce.Path)
+			}
+			current[ce.Path] = ce.Size
+		} else if strings.HasPrefix(ce.Path, "b-") || strings.HasPrefix(ce.Path, "d-") {
+			nVersions++
+		}
+	}
+	for name, exp := range expected {
+		if size, ok := current[name]; ok != (len(exp.dst) != 0) || size != int64(len(exp.dst)) {
+			t.Errorf("%s in the catalog: %v, size %d. Expected %q", name, ok, size, exp.dst)
+		}
+	}
+	if nVersions != 2 { //the deleted file and the one replaced
+		t.Errorf("%d archived versions in the catalog. Expected 2", nVersions)
+	}
+}
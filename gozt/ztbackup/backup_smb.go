@@ -0,0 +1,266 @@
+package ztbackup
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hirochachacha/go-smb2"
+)
+
+type SmbBackupFolder struct {
+	rootPerm     fs.FileMode
+	rootUrl      *url.URL
+	szShare      string
+	szRootFolder string
+
+	smbConn    net.Conn
+	smbDialer  *smb2.Dialer
+	smbSession *smb2.Session
+	smbShare   *smb2.Share
+	rc         ztReconnect
+}
+
+// the share of the current connection (see ztReconnect)
+func (bkps *SmbBackupFolder) share() *smb2.Share {
+	bkps.rc.mu.RLock()
+	defer bkps.rc.mu.RUnlock()
+	return bkps.smbShare
+}
+
+func (bkps *SmbBackupFolder) Retries() int64 {
+	return bkps.rc.retries.Load()
+}
+
+// func (bkps *SmbBackupFolder) getUrl() *url.URL {
+// 	return bkps.rootUrl
+// }
+
+func (bkps *SmbBackupFolder) Perm() fs.FileMode {
+	return bkps.rootPerm
+}
+func (bkps *SmbBackupFolder) SetRootMode(fm fs.FileMode) {
+	bkps.rootPerm = fm
+}
+
+func (bkps *SmbBackupFolder) RootFolder() string {
+	return bkps.szRootFolder
+}
+
+func (bkps *SmbBackupFolder) Stat(name string) (fi fs.FileInfo, err error) {
+	err = bkps.rc.do(func() error {
+		fi, err = bkps.share().Stat(name)
+		return err
+	})
+	return fi, err
+}
+func (bkps *SmbBackupFolder) MkdirAll(path string, perm fs.FileMode) error {
+	return bkps.rc.do(func() error { return bkps.share().MkdirAll(path, perm) })
+}
+
+func (bkps *SmbBackupFolder) Open(path string, name string) (io.ReadCloser, error) {
+	var fl *smb2.File
+	err := bkps.rc.do(func() error {
+		var err error
+		fl, err = bkps.share().Open(prepareTargetName(bkps, path, name))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fl, nil
+}
+
+func (bkps *SmbBackupFolder) Create(path string, name string) (io.WriteCloser, error) {
+	var fl *smb2.File
+	err := bkps.rc.do(func() error {
+		var err error
+		fl, err = bkps.share().Create(prepareTargetName(bkps, path, name))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fl, nil
+}
+
+func (bkps *SmbBackupFolder) CreateNewFile(path string, name string, data []byte) error {
+	target := prepareTargetName(bkps, path, name)
+	return bkps.rc.doCreate(data, func() error {
+		share := bkps.share()
+		fl, err := share.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil {
+			if _, errStat := share.Lstat(target); errStat == nil {
+				return &fs.PathError{Op: "create", Path: target, Err: fs.ErrExist}
+			}
+			return err
+		}
+		_, err = fl.Write(data)
+		if errClose := fl.Close(); err == nil {
+			err = errClose
+		}
+		return err
+	}, func() ([]byte, error) { return bkps.share().ReadFile(target) })
+}
+
+func (bkps *SmbBackupFolder) ReadWholeFile(path string, name string) (data []byte, err error) {
+	err = bkps.rc.do(func() error {
+		data, err = bkps.share().ReadFile(prepareTargetName(bkps, path, name))
+		return err
+	})
+	return data, err
+}
+
+func (bkps *SmbBackupFolder) FreeSpace() (free int64, total int64, err error) {
+	err = bkps.rc.do(func() error {
+		fsi, err := bkps.share().Statfs(bkps.szRootFolder)
+		if err != nil {
+			return err
+		}
+		unit := fsi.BlockSize() * fsi.FragmentSize() //bytes per sector * sectors per allocation unit
+		free, total = int64(fsi.AvailableBlockCount()*unit), int64(fsi.TotalBlockCount()*unit)
+		return nil
+	})
+	return free, total, err
+}
+
+func (bkps *SmbBackupFolder) Close() {
+	bkps.rc.mu.Lock()
+	defer bkps.rc.mu.Unlock()
+	bkps.smbShare.Umount()
+	bkps.smbSession.Logoff()
+	bkps.smbConn.Close()
+}
+
+func (bkps *SmbBackupFolder) SetParams(path string, name string, modTime time.Time, perm fs.FileMode) error {
+	err := bkps.rc.do(func() error { return bkps.share().Chtimes(prepareTargetName(bkps, path, name), modTime, modTime) })
+	err2 := bkps.rc.do(func() error { return bkps.share().Chmod(prepareTargetName(bkps, path, name), perm) })
+	if err != nil { //we will try and do both but return either error.
+		return err
+	}
+	return err2
+}
+
+func (bkps *SmbBackupFolder) DeleteFile(path string, name string) error {
+	return bkps.rc.do(func() error { return bkps.share().Remove(prepareTargetName(bkps, path, name)) })
+}
+
+func (bkps *SmbBackupFolder) RemoveAll(path string) error {
+	return bkps.rc.do(func() error { return bkps.share().RemoveAll(prepareTargetName(bkps, path, "")) })
+}
+
+func (bkps *SmbBackupFolder) Rename(oldpath string, newpath string) error {
+	return bkps.rc.do(func() error { return bkps.share().Rename(oldpath, newpath) })
+}
+
+func (bkps *SmbBackupFolder) ReadFolder(path string) (fis []os.FileInfo, err error) {
+	err = bkps.rc.do(func() error {
+		fpr, err := bkps.share().Open(path)
+		if err != nil {
+			return err
+		}
+		defer fpr.Close()
+		fis, err = fpr.Readdir(0)
+		return err
+	})
+	return fis, err
+}
+
+// NTSTATUS codes (see MS-ERREF) telling why a connection was refused
+const (
+	ntStatusAccessDenied   = 0xC0000022
+	ntStatusLogonFailure   = 0xC000006D
+	ntStatusBadNetworkName = 0xC00000CC
+)
+
+// the kind of FolderError for an error from the server
+func smbErrorKind(err error, kind error) error {
+	var respErr *smb2.ResponseError
+	if errors.As(err, &respErr) {
+		switch respErr.Code {
+		case ntStatusAccessDenied, ntStatusLogonFailure:
+			return ErrAuthFailed
+		case ntStatusBadNetworkName:
+			return ErrShareMissing
+		}
+		return nil
+	}
+	return kind
+}
+
+func InitializeToPathSmb(szUrl *url.URL, pSrc BackupFolder, fo FolderOptions) (BackupFolder, error) {
+	var bkps SmbBackupFolder
+
+	bkps.rootUrl = szUrl
+
+	//remove any leading slashes and then cut the string at first '/' to separate the share name from folder path
+	str1, str2, _ := strings.Cut(strings.TrimLeft(szUrl.Path, "/"), "/")
+	bkps.szShare = str1
+	bkps.szRootFolder = str2 //szRootFolder may be empty if the root of the share is supposed to be used for backup
+
+	username := szUrl.User.Username()
+	pass, _ := szUrl.User.Password()
+
+	if len(username) == 0 {
+		username = "Guest" //or should it be empty?
+	}
+
+	bkps.smbDialer = &smb2.Dialer{
+		Initiator: &smb2.NTLMInitiator{
+			User:     username,
+			Password: pass,
+		},
+	}
+
+	bkps.rc.label = FolderLabel(szUrl.String())
+	bkps.rc.connect = bkps.connect
+	bkps.rc.ctx = fo.Context
+	bkps.rc.log = fo.Log
+	if err := bkps.connect(); err != nil {
+		return nil, err
+	}
+	if err := checkExists(&bkps, pSrc, szUrl.String(), fo.Log); err != nil {
+		bkps.Close()
+		return nil, err
+	}
+	return &bkps, nil
+}
+
+// connects to the server and mounts the share, dropping the previous connection (if any)
+func (bkps *SmbBackupFolder) connect() error {
+	if bkps.smbConn != nil {
+		bkps.smbConn.Close() //the session and the share go with it
+	}
+
+	szPort := bkps.rootUrl.Port()
+	if len(szPort) == 0 {
+		szPort = "445"
+	}
+
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(bkps.rootUrl.Hostname(), szPort), connectTimeout)
+	if err != nil {
+		return newFolderError(bkps.rootUrl.String(), ErrHostUnreachable, fmt.Errorf("error connecting to SMB server %s : %w", bkps.rootUrl.Host, err))
+	}
+
+	s, err := bkps.smbDialer.Dial(conn)
+	if err != nil {
+		conn.Close()
+		return newFolderError(bkps.rootUrl.String(), smbErrorKind(err, ErrHostUnreachable), fmt.Errorf("error dialing in to SMB server %s : %w", bkps.rootUrl.Host, err))
+	}
+
+	fs, err := s.Mount(bkps.szShare)
+	if err != nil {
+		s.Logoff()
+		conn.Close()
+		return newFolderError(bkps.rootUrl.String(), smbErrorKind(err, nil), fmt.Errorf("accessing share %s in SMB server %s : %w", bkps.szShare, bkps.rootUrl.Host, err))
+	}
+
+	bkps.smbConn, bkps.smbSession, bkps.smbShare = conn, s, fs
+	return nil
+}
@@ -0,0 +1,107 @@
+package ztbackup
+
+import (
+	"fmt"
+	"io/fs"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/text/message"
+)
+
+// Backups made by other tools as dated snapshot generations (a full copy of the tree per generation, in folders
+// named after the time they were taken, e.g. 2026-09-01 or 2026-09-01_14-00-00) can be restored and listed as
+// well. A restore picks the newest generation taken at or before --as-of, so the tree is as it was when that
+// snapshot was taken.
+//
+// A backup is taken as generations only if everything at its root is a dated folder. A gozt destination is
+// never taken as one: it has a .ztid file (and its old versions in .ztversions).
+var snapshotFormats = []string{"2006-01-02_15-04-05", "2006-01-02T15-04-05", "2006-01-02-150405", "2006-01-02"}
+
+type snapshot struct {
+	name  string
+	taken time.Time
+}
+
+// the time a generation was taken (local time), from its folder name
+func parseSnapshotName(name string) (time.Time, bool) {
+	for _, layout := range snapshotFormats {
+		if t, err := time.ParseInLocation(layout, name, time.Local); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// the dated snapshot generations at the root of the backup, oldest first. None if it is not made of them.
+func listSnapshots(bkps BackupFolder) []snapshot {
+	fis, err := ReadDir(bkps, "")
+	if err != nil {
+		return nil
+	}
+	var snaps []snapshot
+	for _, fi := range fis {
+		if fi.Name() == catalogIdFile || fi.Name() == versionFolder {
+			return nil //a gozt destination
+		}
+		if isDestinationMeta(fi.Name()) {
+			continue
+		}
+		taken, ok := parseSnapshotName(fi.Name())
+		if !ok || !fi.IsDir() {
+			return nil
+		}
+		snaps = append(snaps, snapshot{fi.Name(), taken})
+	}
+	sort.Slice(snaps, func(i, j int) bool { return snaps[i].taken.Before(snaps[j].taken) })
+	return snaps
+}
+
+// the newest generation taken at or before asOf. nil if there is none.
+func snapshotAt(snaps []snapshot, asOf time.Time) *snapshot {
+	var found *snapshot
+	for i := range snaps {
+		if !snaps[i].taken.After(asOf) {
+			found = &snaps[i]
+		}
+	}
+	return found
+}
+
+// the folder or URL of a generation of szBackup
+func snapshotPath(szBackup string, snap *snapshot) string {
+	if strings.HasPrefix(szBackup, "smb://") || strings.HasPrefix(szBackup, "sftp://") || strings.HasPrefix(szBackup, "ssh://") {
+		if foldURL, err := url.Parse(szBackup); err == nil {
+			return foldURL.JoinPath(snap.name).String()
+		}
+	}
+	return filepath.Join(szBackup, snap.name)
+}
+
+// lists the copies of a file (path, name) in every generation (see ListVersions)
+func (bkp *Backup) listSnapshotVersions(bkps BackupFolder, snaps []snapshot, path string, name string) error {
+	pr := message.NewPrinter(message.MatchLanguage("en"))
+	found := false
+	for _, snap := range snaps {
+		snapPath := snap.name
+		if len(path) != 0 {
+			snapPath = bkp.prepareName(snap.name, path)
+		}
+		fi, err := getFileInfo(bkps, snapPath, name)
+		if err != nil || !fi.Mode().IsRegular() {
+			continue
+		}
+		if !found {
+			pr.Fprintf(bkp.console(), "\r\n                size (bytes)  modified time                  snapshot\r\n")
+			found = true
+		}
+		pr.Fprintf(bkp.console(), "%28d  %s  %s\r\n", fi.Size(), fi.ModTime().Format("2006-01-02 15:04:05 MST"), snap.name)
+	}
+	if !found {
+		return fmt.Errorf("'%s' is in none of the %d snapshots: %w", bkp.prepareName(path, name), len(snaps), fs.ErrNotExist)
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package ztbackup
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Before a file is copied, gozt checks that it fits in the free space of the destination and in its quota
+// (--quota or "quota" in jobs.toml: bytes, or percent of the size of the file system, that the destination
+// folder may use, for every destination or per destination). A file that does not fit is not copied and is reported as an error. With
+// --space-check=abort the run stops instead, and with --prescan the bytes to copy are checked before anything
+// is copied. Files deleted from the destination (not archived: old versions stay in it) free their space.
+//
+// The free space is queried at the start of the run, then again whenever a file may not fit in what is left
+// of it, or spaceRequery after the last query (other programs may be writing to the same drive).
+const spaceRequery = time.Minute
+
+const (
+	spaceWarn  = "warn"
+	spaceAbort = "abort"
+	spaceOff   = "off"
+)
+
+var ErrNoSpace = errors.New("not enough space")
+
+type ztSpace struct {
+	quota     int64     //bytes the destination folder may use. 0 for no quota
+	used      int64     //bytes used by the destination folder. Only counted with a quota.
+	free      int64     //free bytes as last queried, less what was copied since
+	queried   time.Time //zero if the destination can't tell its free space
+	projected int64     //bytes to copy to this destination, counted by --prescan
+}
+
+// the quota of one destination
+type DestQuota struct {
+	Bytes   int64
+	Percent float64 //of the size of its file system, instead of Bytes
+}
+
+// --quota: e.g. 500G or 80%
+func ParseQuota(szQuota string) (int64, float64, error) {
+	if szPct, ok := strings.CutSuffix(strings.TrimSpace(szQuota), "%"); ok {
+		pct, err := strconv.ParseFloat(szPct, 64)
+		if err != nil || pct <= 0 || pct > 100 {
+			return 0, 0, fmt.Errorf("invalid quota '%s'", szQuota)
+		}
+		return 0, pct, nil
+	}
+	quota, err := ParseByteSize(szQuota)
+	return quota, 0, err
+}
+
+// --quota with a quota per destination, e.g. /mnt/usb=500G,sftp://me@nas/backup=80%
+func ParseDestQuotas(szQuotas string) (map[string]DestQuota, error) {
+	quotas := make(map[string]DestQuota)
+	for _, szEntry := range strings.Split(szQuotas, ",") {
+		i := strings.LastIndex(szEntry, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid quota '%s'. Expecting destination=quota", szEntry)
+		}
+		var dq DestQuota
+		var err error
+		if dq.Bytes, dq.Percent, err = ParseQuota(szEntry[i+1:]); err != nil {
+			return nil, err
+		}
+		quotas[szEntry[:i]] = dq
+	}
+	return quotas, nil
+}
+
+// accepts a number of bytes with an optional K, M, G or T suffix (1024 based)
+func ParseByteSize(szSize string) (int64, error) {
+	szSize = strings.ToUpper(strings.TrimSpace(szSize))
+	mult := int64(1)
+	switch {
+	case strings.HasSuffix(szSize, "K"):
+		mult = 1024
+	case strings.HasSuffix(szSize, "M"):
+		mult = 1024 * 1024
+	case strings.HasSuffix(szSize, "G"):
+		mult = 1024 * 1024 * 1024
+	case strings.HasSuffix(szSize, "T"):
+		mult = 1024 * 1024 * 1024 * 1024
+	}
+	if mult != 1 {
+		szSize = szSize[:len(szSize)-1]
+	}
+	n, err := strconv.ParseInt(szSize, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size '%s'", szSize)
+	}
+	return n * mult, nil
+}
+
+func ParseSpaceCheck(szCheck string) (string, error) {
+	switch szCheck {
+	case "":
+		return spaceWarn, nil
+	case spaceWarn, spaceAbort, spaceOff:
+		return szCheck, nil
+	}
+	return "", fmt.Errorf("invalid space check '%s'. Expecting warn, abort or off", szCheck)
+}
+
+// queries the free space of every destination and, with a quota, how much of it is used
+func (bkp *Backup) openSpace() {
+	if bkp.SpaceCheck == spaceOff {
+		return
+	}
+	unused := make(map[string]bool, len(bkp.Quotas))
+	for szDst := range bkp.Quotas {
+		unused[szDst] = true
+	}
+	for _, dest := range bkp.destinations() {
+		dq := DestQuota{bkp.Quota, bkp.QuotaPercent}
+		for _, szDst := range []string{dest.dstLabel, FolderLabel(dest.dstLabel)} {
+			if q, ok := bkp.Quotas[szDst]; ok {
+				dq = q
+				delete(unused, szDst)
+			}
+		}
+		sp := &ztSpace{quota: dq.Bytes}
+		free, total, err := (*dest.dstBack).FreeSpace()
+		if err != nil {
+			bkp.LogPrintf("\rUnable to get the free space of %s (%v). It will not be checked.\r\n", FolderLabel(dest.dstLabel), err)
+		} else {
+			sp.free, sp.queried = free, time.Now()
+		}
+		if dq.Percent != 0 {
+			if err != nil {
+				bkp.LogPrintf("\rThe quota of %s can't be checked without the size of its file system.\r\n", FolderLabel(dest.dstLabel))
+			} else {
+				sp.quota = int64(float64(total) * dq.Percent / 100)
+			}
+		}
+		if sp.quota != 0 {
+			sp.used = dest.destinationUsage()
+			bkp.LogPrintf("\r%s uses %s of its quota of %s\r\n", FolderLabel(dest.dstLabel), FormatBytes(sp.used), FormatBytes(sp.quota))
+		}
+		dest.space = sp
+	}
+	for szDst := range unused {
+		bkp.LogPrintf("\rWARNING: %s has a quota but is not a destination of this run.\r\n", szDst)
+	}
+}
+
+// the size of the destination folder (old versions included). Taken from the catalog of the last run if
+// there is one, since counting means listing every folder of the destination.
+func (bkp *Backup) destinationUsage() int64 {
+	if bkp.catalog != nil && len(bkp.catalog.old) != 0 {
+		var used int64
+		for _, ce := range bkp.catalog.old {
+			used += ce.Size
+		}
+		return used
+	}
+	_, used := bkp.countFolder(*bkp.dstBack, "")
+	return used
+}
+
+// why needed bytes do not fit in the destination. nil if they do.
+func (bkp *Backup) spaceError(needed int64) error {
+	sp := bkp.space
+	if sp.quota != 0 && sp.used+needed > sp.quota {
+		return fmt.Errorf("%w in the quota of %s (%s needed, %s used of %s)", ErrNoSpace, FolderLabel(bkp.dstLabel),
+			FormatBytes(needed), FormatBytes(sp.used), FormatBytes(sp.quota))
+	}
+	if !sp.queried.IsZero() && needed > sp.free {
+		return fmt.Errorf("%w on %s (%s needed, %s free)", ErrNoSpace, FolderLabel(bkp.dstLabel), FormatBytes(needed), FormatBytes(sp.free))
+	}
+	return nil
+}
+
+// with --prescan, checks that what is going to be copied fits in every destination before copying anything.
+// Returns the error with --space-check=abort.
+func (bkp *Backup) checkProjectedSpace() error {
+	for _, dest := range bkp.destinations() {
+		if dest.space == nil {
+			continue
+		}
+		if err := dest.spaceError(dest.space.projected); err != nil {
+			if bkp.SpaceCheck == spaceAbort {
+				bkp.LogPrintf("\rAborting: %v. Nothing was copied.\r\n", err)
+				return err
+			}
+			bkp.LogPrintf("\rWARNING: %v. Files that do not fit will not be copied.\r\n", err)
+		}
+	}
+	return nil
+}
+
+// checks that the file fits in the destination before it is copied (over fDst, if not nil) and counts it
+// as used. Reports the file if it does not fit and, with --space-check=abort, stops the run.
+func (bkp *Backup) checkSpace(path string, fSrc fs.FileInfo, fDst fs.FileInfo) bool {
+	sp := bkp.space
+	if sp == nil {
+		return true
+	}
+	needed := fSrc.Size()
+	if fDst != nil && !bkp.VersionFlag {
+		needed -= fDst.Size() //the old file is overwritten
+	}
+	if needed <= 0 {
+		return true
+	}
+	if !sp.queried.IsZero() && (needed > sp.free || time.Since(sp.queried) > spaceRequery) {
+		if free, _, err := (*bkp.dstBack).FreeSpace(); err == nil {
+			sp.free, sp.queried = free, time.Now()
+		}
+	}
+	if err := bkp.spaceError(needed); err != nil {
+		bkp.reportError(bkp.prepareName(path, fSrc.Name()), "Not copied", err)
+		if bkp.SpaceCheck == spaceAbort && bkp.cancelRun != nil {
+			bkp.cancelRun(fmt.Errorf("stopped: %w", err))
+		}
+		return false
+	}
+	sp.used += needed
+	sp.free -= needed
+	return true
+}
+
+// counts the bytes deleted from the destination as free again
+func (bkp *Backup) spaceFreed(size int64) {
+	if sp := bkp.space; sp != nil {
+		sp.used -= size
+		sp.free += size
+	}
+}
@@ -0,0 +1,114 @@
+package ztbackup
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestParseQuota(t *testing.T) {
+	tests := []struct {
+		in    string
+		bytes int64
+		pct   float64
+		ok    bool
+	}{
+		{"500G", 500 << 30, 0, true},
+		{"2T", 2 << 40, 0, true},
+		{"80%", 0, 80, true},
+		{"0%", 0, 0, false},
+		{"120%", 0, 0, false},
+		{"lots", 0, 0, false},
+	}
+	for _, tt := range tests {
+		bytes, pct, err := ParseQuota(tt.in)
+		if (err == nil) != tt.ok || bytes != tt.bytes || pct != tt.pct {
+			t.Errorf("ParseQuota(%q) = %d, %v, %v", tt.in, bytes, pct, err)
+		}
+	}
+
+	quotas, err := ParseDestQuotas("/mnt/usb=500G,sftp://me@nas/a=b=80%")
+	expected := map[string]DestQuota{"/mnt/usb": {Bytes: 500 << 30}, "sftp://me@nas/a=b": {Percent: 80}}
+	if err != nil || !reflect.DeepEqual(quotas, expected) {
+		t.Errorf("ParseDestQuotas: %v, %v", quotas, err)
+	}
+	for _, in := range []string{"/mnt/usb=500G,80%", "=500G", "/mnt/usb=lots"} {
+		if _, err := ParseDestQuotas(in); err == nil {
+			t.Errorf("ParseDestQuotas(%q): no error", in)
+		}
+	}
+}
+
+func TestCheckSpace(t *testing.T) {
+	info := func(size int) fs.FileInfo {
+		fi, _ := fstest.MapFS{"f": &fstest.MapFile{Data: make([]byte, size)}}.Stat("f")
+		return fi
+	}
+	var bkp Backup
+	bkp.Log.Dir = t.TempDir()
+	bkp.space = &ztSpace{quota: 1100, used: 400, free: 10000, queried: time.Now()}
+
+	if !bkp.checkSpace("", info(500), nil) {
+		t.Errorf("500 bytes should fit")
+	}
+	//replaces a file of 300 bytes, so only 200 more are used
+	if !bkp.checkSpace("", info(500), info(300)) || bkp.space.used != 1100 {
+		t.Errorf("replacement: used %d", bkp.space.used)
+	}
+	if bkp.checkSpace("", info(1), nil) {
+		t.Errorf("quota exceeded but the file was accepted")
+	}
+	if err := bkp.spaceError(1); !errors.Is(err, ErrNoSpace) {
+		t.Errorf("expected ErrNoSpace, got %v", err)
+	}
+	bkp.spaceFreed(300) //a file deleted from the destination
+	if !bkp.checkSpace("", info(300), nil) {
+		t.Errorf("the space of the deleted file was not freed")
+	}
+}
+
+func TestProjectedSpace(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	src, dst := t.TempDir(), t.TempDir()
+	old := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	for _, file := range []struct {
+		dir, name string
+		size      int
+	}{
+		{src, "changed", 100},
+		{dst, "changed", 60},
+		{dst, "gone", 50},
+		{src, "folder/f", 10},
+		{dst, "gone-folder/f", 40},
+	} {
+		fPath := filepath.Join(file.dir, file.name)
+		os.MkdirAll(filepath.Dir(fPath), 0o755)
+		if err := os.WriteFile(fPath, make([]byte, file.size), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(fPath, old, old)
+	}
+	os.Chtimes(filepath.Join(src, "changed"), old.Add(time.Hour), old.Add(time.Hour))
+
+	bkp := Backup{Options: Options{FileOption: OptDelete, FolderOption: OptDelete, RecursiveFlag: true, PrescanFlag: true,
+		Quotas: map[string]DestQuota{dst: {Bytes: 1 << 20}, "/elsewhere": {Bytes: 1}}}}
+	if err := bkp.Run(context.Background(), src, []string{dst}, FolderOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if bkp.space.quota != 1<<20 {
+		t.Errorf("quota %d. Expected the one of %s", bkp.space.quota, dst)
+	}
+	//110 bytes to copy, but 60 are overwritten and 90 deleted
+	if bkp.space.projected != -40 {
+		t.Errorf("%d bytes projected. Expected -40", bkp.space.projected)
+	}
+	if bkp.Statistics.NumFilesCopied != 2 || bkp.Statistics.NumFilesDeleted != 2 {
+		t.Errorf("%d files copied and %d deleted. Expected 2 and 2", bkp.Statistics.NumFilesCopied, bkp.Statistics.NumFilesDeleted)
+	}
+}
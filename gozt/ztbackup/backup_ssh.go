@@ -0,0 +1,323 @@
+package ztbackup
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/url"
+	"os"
+	"os/user"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// implementation of BackupFolder with Ssh
+type SftpBackupFolder struct {
+	rootPerm fs.FileMode
+	rootUrl  *url.URL
+
+	sshClient  *ssh.Client
+	sftpClient *sftp.Client
+	sshConf    *ssh.ClientConfig
+	rc         ztReconnect
+}
+
+// the client of the current connection (see ztReconnect)
+func (bkps *SftpBackupFolder) client() *sftp.Client {
+	bkps.rc.mu.RLock()
+	defer bkps.rc.mu.RUnlock()
+	return bkps.sftpClient
+}
+
+func (bkps *SftpBackupFolder) Retries() int64 {
+	return bkps.rc.retries.Load()
+}
+
+func (bkps *SftpBackupFolder) Perm() fs.FileMode {
+	return bkps.rootPerm
+}
+
+// func (bkps *SftpBackupFolder) getUrl() *url.URL {
+// 	return bkps.rootUrl
+// }
+
+func (bkps *SftpBackupFolder) RootFolder() string {
+	return bkps.rootUrl.Path
+}
+
+func (bkps *SftpBackupFolder) SetRootMode(fm fs.FileMode) {
+	bkps.rootPerm = fm
+}
+
+func (bkps *SftpBackupFolder) Stat(name string) (fi fs.FileInfo, err error) {
+	err = bkps.rc.do(func() error {
+		fi, err = bkps.client().Stat(name)
+		return err
+	})
+	return fi, err
+}
+
+func (bkps *SftpBackupFolder) MkdirAll(path string, perm fs.FileMode) error {
+	return bkps.rc.do(func() error { return bkps.client().MkdirAll(path) })
+}
+
+func (bkps *SftpBackupFolder) ReadFolder(path string) (fis []os.FileInfo, err error) {
+	err = bkps.rc.do(func() error {
+		fis, err = bkps.client().ReadDir(path)
+		return err
+	})
+	return fis, err
+}
+
+// the file reads ahead with concurrent requests in WriteTo
+func (bkps *SftpBackupFolder) Open(path string, name string) (io.ReadCloser, error) {
+	var fl *sftp.File
+	err := bkps.rc.do(func() error {
+		var err error
+		fl, err = bkps.client().Open(prepareTargetName(bkps, path, name))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fl, nil
+}
+
+// the file writes with concurrent requests in ReadFrom
+func (bkps *SftpBackupFolder) Create(path string, name string) (io.WriteCloser, error) {
+	var fl *sftp.File
+	err := bkps.rc.do(func() error {
+		var err error
+		fl, err = bkps.client().Create(prepareTargetName(bkps, path, name))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fl, nil
+}
+
+func (bkps *SftpBackupFolder) CreateNewFile(path string, name string, data []byte) error {
+	target := prepareTargetName(bkps, path, name)
+	return bkps.rc.doCreate(data, func() error {
+		client := bkps.client()
+		fl, err := client.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+		if err != nil {
+			//servers report an existing file in different ways
+			if _, errStat := client.Lstat(target); errStat == nil {
+				return &fs.PathError{Op: "create", Path: target, Err: fs.ErrExist}
+			}
+			return err
+		}
+		_, err = fl.Write(data)
+		if errClose := fl.Close(); err == nil {
+			err = errClose
+		}
+		return err
+	}, func() ([]byte, error) {
+		fl, err := bkps.client().Open(target)
+		if err != nil {
+			return nil, err
+		}
+		defer fl.Close()
+		return io.ReadAll(fl)
+	})
+}
+
+func (bkps *SftpBackupFolder) ReadWholeFile(path string, name string) (data []byte, err error) {
+	err = bkps.rc.do(func() error {
+		fl, err := bkps.client().Open(prepareTargetName(bkps, path, name))
+		if err != nil {
+			return err
+		}
+		defer fl.Close()
+		data, err = io.ReadAll(fl)
+		return err
+	})
+	return data, err
+}
+
+// needs the statvfs@openssh.com extension (OpenSSH and most others)
+func (bkps *SftpBackupFolder) FreeSpace() (free int64, total int64, err error) {
+	err = bkps.rc.do(func() error {
+		st, err := bkps.client().StatVFS(bkps.rootUrl.Path)
+		if err != nil {
+			return err
+		}
+		free, total = int64(st.Bavail*st.Frsize), int64(st.TotalSpace())
+		return nil
+	})
+	return free, total, err
+}
+
+func (bkps *SftpBackupFolder) Close() {
+	bkps.rc.mu.Lock()
+	defer bkps.rc.mu.Unlock()
+	bkps.sftpClient.Close()
+	bkps.sshClient.Close()
+}
+
+func (bkps *SftpBackupFolder) SetParams(path string, name string, modTime time.Time, perm fs.FileMode) error {
+	err := bkps.rc.do(func() error { return bkps.client().Chtimes(prepareTargetName(bkps, path, name), modTime, modTime) })
+	err2 := bkps.rc.do(func() error { return bkps.client().Chmod(prepareTargetName(bkps, path, name), perm) })
+	if err != nil { //we will try and do both but return either error.
+		return err
+	}
+	return err2
+}
+
+func (bkps *SftpBackupFolder) DeleteFile(path string, name string) error {
+	return bkps.rc.do(func() error { return bkps.client().Remove(prepareTargetName(bkps, path, name)) })
+}
+
+func (bkps *SftpBackupFolder) RemoveAll(path string) error {
+	return bkps.rc.do(func() error { return bkps.client().RemoveAll(prepareTargetName(bkps, path, "")) })
+}
+
+func (bkps *SftpBackupFolder) Rename(oldpath string, newpath string) error {
+	return bkps.rc.do(func() error { return bkps.client().Rename(oldpath, newpath) })
+}
+
+// reads the specified private key. If none is specified, ~/.ssh/id_rsa or ~/.ssh/id_ed25519 is used.
+func readSshKey(keyLoc string) ([]byte, error) {
+	if len(keyLoc) != 0 {
+		return os.ReadFile(ExpandHome(keyLoc))
+	}
+	hdir, err := os.UserHomeDir()
+	if err != nil {
+		u, err := user.Current()
+		if err != nil {
+			return nil, fmt.Errorf("unable to get current user: %w", err)
+		}
+		hdir = u.HomeDir
+	}
+	keyLoc = fmt.Sprintf("%s/.ssh/id_rsa", hdir)
+	key, err := os.ReadFile(keyLoc)
+	if err != nil {
+		keyLoc = fmt.Sprintf("%s/.ssh/id_ed25519", hdir)
+		key, err = os.ReadFile(keyLoc)
+	}
+	return key, err
+}
+
+func InitializeToPathSftp(szRoot *url.URL, pSrc BackupFolder, fo FolderOptions) (BackupFolder, error) {
+	var bkps SftpBackupFolder
+
+	bkps.rootUrl = szRoot
+
+	//TODO: Sanity check. Make sure server name is present.
+
+	//0. We have to have a user.
+	if szRoot.User == nil || len(szRoot.User.Username()) == 0 {
+		return nil, newFolderError(szRoot.String(), ErrInvalidURL, fmt.Errorf("missing username for SSH/SFTP in %s folder", strings.ToLower(getBackupFolderType(pSrc))))
+	}
+
+	passString, isPassword := szRoot.User.Password()
+
+	var conf *ssh.ClientConfig
+
+	if !isPassword {
+		//use RSA keys
+		key, err := readSshKey(fo.SshKey)
+		if err != nil {
+			return nil, newFolderError(szRoot.String(), ErrAuthFailed, fmt.Errorf("unable to read private SSH/RSA key: %w", err))
+		}
+		// Create the Signer for this private key.
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, newFolderError(szRoot.String(), ErrAuthFailed, fmt.Errorf("unable to parse private key: %w", err))
+		}
+		conf = &ssh.ClientConfig{
+			User: szRoot.User.Username(),
+			Auth: []ssh.AuthMethod{
+				// Use the PublicKeys method for remote authentication.
+				ssh.PublicKeys(signer),
+			},
+			HostKeyCallback: ssh.HostKeyCallback(func(hostname string, remote net.Addr, key ssh.PublicKey) error { return nil }),
+		}
+	} else {
+		//use pass authentication
+		conf = &ssh.ClientConfig{
+			User: szRoot.User.Username(),
+			Auth: []ssh.AuthMethod{
+				ssh.Password(passString),
+			},
+			HostKeyCallback: ssh.HostKeyCallback(func(hostname string, remote net.Addr, key ssh.PublicKey) error { return nil }),
+		}
+	}
+	conf.Timeout = connectTimeout
+	bkps.sshConf = conf
+
+	bkps.rc.label = FolderLabel(szRoot.String())
+	bkps.rc.connect = bkps.connect
+	bkps.rc.ctx = fo.Context
+	bkps.rc.log = fo.Log
+	if err := bkps.connect(); err != nil {
+		return nil, err
+	}
+	if err := checkExists(&bkps, pSrc, szRoot.String(), fo.Log); err != nil {
+		bkps.Close()
+		return nil, err
+	}
+	return &bkps, nil
+}
+
+// connects to the server, dropping the previous connection (if any)
+func (bkps *SftpBackupFolder) connect() error {
+	if bkps.sshClient != nil {
+		bkps.sshClient.Close() //the sftp client goes with it
+	}
+
+	szPort := bkps.rootUrl.Port()
+	if len(szPort) == 0 {
+		szPort = "22"
+	}
+
+	client, err := ssh.Dial("tcp", net.JoinHostPort(bkps.rootUrl.Hostname(), szPort), bkps.sshConf)
+	if err != nil {
+		var netErr net.Error
+		kind := ErrHostUnreachable
+		if !errors.As(err, &netErr) && strings.Contains(err.Error(), "unable to authenticate") {
+			kind = ErrAuthFailed //the ssh package has no error type for it
+		}
+		return newFolderError(bkps.rootUrl.String(), kind, fmt.Errorf("failed to connect to %s : %w", bkps.rootUrl.Host, err))
+	}
+
+	ft_conn, err := sftp.NewClient(client)
+	if err != nil {
+		client.Close()
+		return newFolderError(bkps.rootUrl.String(), nil, fmt.Errorf("failed to start SFTP: %w", err))
+	}
+
+	bkps.sshClient, bkps.sftpClient = client, ft_conn
+	go sshKeepAlive(client)
+	return nil
+}
+
+// A connection that stops answering (e.g. the network is gone without the server closing it) would
+// otherwise leave gozt waiting forever. It is closed instead, so that the waiting operations fail and
+// are retried on a new connection.
+func sshKeepAlive(client *ssh.Client) {
+	for {
+		time.Sleep(keepAliveInterval)
+		reply := make(chan error, 1)
+		go func() {
+			_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+			reply <- err
+		}()
+		select {
+		case err := <-reply:
+			if err != nil {
+				return //closed
+			}
+		case <-time.After(keepAliveInterval):
+			client.Close()
+			return
+		}
+	}
+}
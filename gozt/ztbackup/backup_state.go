@@ -0,0 +1,364 @@
+package ztbackup
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	mrand "math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// The listings of a destination's folders are kept under ~/.ztbackup/state after a run, so that the next run
+// does not have to list them all again over SMB or SFTP: only the source is walked, and a destination folder is
+// listed again only once something was written to it.
+//
+// The saved listings are only good as long as nothing else writes to the destination. Each run writes a new
+// random token to a .ztstate file at the root of the destination, and the listings are saved with it at the
+// end of a run that completed. A run that finds another token (another machine backed up there, or the run
+// that wrote it did not complete) lists everything. A few folders are also listed anyway and checked against
+// the saved listings, which catches most changes made by hand. --rescan lists everything.
+const stateFolder = "state"
+const stateTokenFile = ".ztstate"
+const stateSpotChecks = 3
+
+type StateHeader struct {
+	Id      string    `json:"id"`
+	Label   string    `json:"label"`
+	Token   string    `json:"token"`
+	Updated time.Time `json:"updated"`
+}
+
+type stateFolderListing struct {
+	Path    string       `json:"path"` //relative to the root of the destination
+	Entries []stateEntry `json:"entries"`
+}
+
+type stateEntry struct {
+	Name    string      `json:"name"`
+	Size    int64       `json:"size"`
+	ModTime time.Time   `json:"mtime"`
+	Mode    fs.FileMode `json:"mode"`
+}
+
+func (se stateEntry) fileInfo() fs.FileInfo {
+	return stateFileInfo{se}
+}
+
+type stateFileInfo struct {
+	se stateEntry
+}
+
+func (fi stateFileInfo) Name() string       { return fi.se.Name }
+func (fi stateFileInfo) Size() int64        { return fi.se.Size }
+func (fi stateFileInfo) Mode() fs.FileMode  { return fi.se.Mode }
+func (fi stateFileInfo) ModTime() time.Time { return fi.se.ModTime }
+func (fi stateFileInfo) IsDir() bool        { return fi.se.Mode.IsDir() }
+func (fi stateFileInfo) Sys() any           { return nil }
+
+type ztState struct {
+	header  StateHeader
+	folders map[string][]fs.FileInfo //listings that are still good, by path
+}
+
+func getStatePath(id string) (string, error) {
+	dir, err := ZtFolder()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s%c%s%c%s.state", dir, os.PathSeparator, stateFolder, os.PathSeparator, id), nil
+}
+
+func loadStateFile(fPath string) (StateHeader, map[string][]fs.FileInfo, error) {
+	var hdr StateHeader
+	folders := make(map[string][]fs.FileInfo)
+
+	fl, err := os.Open(fPath)
+	if err != nil {
+		return hdr, nil, err
+	}
+	defer fl.Close()
+
+	scans := bufio.NewScanner(fl)
+	scans.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	if !scans.Scan() {
+		return hdr, nil, fmt.Errorf("empty state %s", fPath)
+	}
+	if err := json.Unmarshal(scans.Bytes(), &hdr); err != nil {
+		return hdr, nil, err
+	}
+	for scans.Scan() {
+		var sl stateFolderListing
+		if err := json.Unmarshal(scans.Bytes(), &sl); err != nil {
+			return hdr, nil, err //a partial state is no good
+		}
+		fis := make([]fs.FileInfo, 0, len(sl.Entries))
+		for _, se := range sl.Entries {
+			fis = append(fis, se.fileInfo())
+		}
+		folders[sl.Path] = fis
+	}
+	return hdr, folders, scans.Err()
+}
+
+func (st *ztState) Save() error {
+	fPath, err := getStatePath(st.header.Id)
+	if err != nil {
+		return err
+	}
+	os.MkdirAll(filepath.Dir(fPath), 0755)
+	fl, err := os.Create(fPath + ".tmp")
+	if err != nil {
+		return err
+	}
+	wr := bufio.NewWriter(fl)
+	enc := json.NewEncoder(wr)
+	st.header.Updated = time.Now()
+	enc.Encode(st.header)
+	for path, fis := range st.folders {
+		sl := stateFolderListing{Path: path, Entries: make([]stateEntry, 0, len(fis))}
+		for _, fi := range fis {
+			sl.Entries = append(sl.Entries, stateEntry{Name: fi.Name(), Size: fi.Size(), ModTime: fi.ModTime(), Mode: fi.Mode()})
+		}
+		enc.Encode(sl)
+	}
+	if err := wr.Flush(); err != nil {
+		fl.Close()
+		return err
+	}
+	if err := fl.Close(); err != nil {
+		return err
+	}
+	return os.Rename(fPath+".tmp", fPath)
+}
+
+// replaces the token of the destination with a new one
+func writeStateToken(bkps BackupFolder) (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(buf)
+	fl, err := bkps.Create("", stateTokenFile)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.WriteString(fl, token+"\n")
+	if errClose := fl.Close(); err == nil {
+		err = errClose
+	}
+	return token, err
+}
+
+// sets up the state of the destination (see above) for the run: the saved listings are used if they can be
+// trusted, and the destination is given a new token. Needs the catalog (for the identity of the destination).
+// Failures are not fatal; the destination is simply listed.
+func (bkp *Backup) openState() {
+	if bkp.catalog == nil {
+		return
+	}
+	id := bkp.catalog.header.Id
+	statePath, err := getStatePath(id)
+	if err != nil {
+		bkp.Println("\rUnable to keep the listings of the destination between runs : ", err)
+		return
+	}
+	var oldToken string
+	if data, err := (*bkp.dstBack).ReadWholeFile("", stateTokenFile); err == nil {
+		oldToken = strings.TrimSpace(string(data))
+	}
+	hdr, folders, errLoad := loadStateFile(statePath)
+
+	token, err := writeStateToken(*bkp.dstBack)
+	if err != nil {
+		bkp.Println("\rUnable to mark the destination for the listings kept between runs : ", err)
+		return
+	}
+	if bkp.WatchFlag {
+		//sync --watch goes on writing to the destination after the run. Its listings are not kept.
+		os.Remove(statePath)
+		return
+	}
+
+	st := &ztState{header: StateHeader{Id: id, Label: bkp.catalog.header.Label, Token: token}, folders: make(map[string][]fs.FileInfo)}
+	sf := &stateBackupFolder{BackupFolder: *bkp.dstBack, state: st}
+	switch {
+	case bkp.RescanFlag || errLoad != nil:
+	case len(oldToken) == 0 || hdr.Token != oldToken:
+		bkp.LogPrintf("\rThe destination was written to by another run since the last one from here. Listing all of it.\r\n")
+	case !sf.spotCheck(folders):
+		bkp.LogPrintf("\rThe destination was changed outside gozt. Listing all of it.\r\n")
+	default:
+		st.folders = folders
+		bkp.LogPrintf("\rUsing the listings of the destination saved by the last run (--rescan to list it again).\r\n")
+	}
+	bkp.state = st
+	*bkp.dstBack = sf
+}
+
+// A destination with its state. The listings are served from the state, and dropped from it whenever the
+// folder is written to.
+type stateBackupFolder struct {
+	BackupFolder
+	state *ztState
+}
+
+// the path of a full name, relative to the root
+func (sf *stateBackupFolder) relPath(full string) (string, bool) {
+	root := sf.RootFolder()
+	if full == root {
+		return "", true
+	}
+	rel, found := strings.CutPrefix(full, root+string(os.PathSeparator))
+	return rel, found
+}
+
+func parentPath(path string) string {
+	if i := strings.LastIndexByte(path, os.PathSeparator); i >= 0 {
+		return path[:i]
+	}
+	return ""
+}
+
+// whether the folder is known to exist
+func (sf *stateBackupFolder) exists(path string) bool {
+	if _, ok := sf.state.folders[path]; ok || len(path) == 0 {
+		return true
+	}
+	fis, ok := sf.state.folders[parentPath(path)]
+	if !ok {
+		return false
+	}
+	name := strings.TrimPrefix(path[len(parentPath(path)):], string(os.PathSeparator))
+	for _, fi := range fis {
+		if fi.Name() == name {
+			return fi.IsDir()
+		}
+	}
+	return false
+}
+
+func (sf *stateBackupFolder) changed(path string) {
+	delete(sf.state.folders, path)
+}
+
+// the folder and everything under it are gone
+func (sf *stateBackupFolder) removed(path string) {
+	sf.changed(parentPath(path))
+	for listed := range sf.state.folders {
+		if listed == path || strings.HasPrefix(listed, path+string(os.PathSeparator)) {
+			delete(sf.state.folders, listed)
+		}
+	}
+}
+
+// lists a few of the folders and compares them with folders (the saved listings)
+func (sf *stateBackupFolder) spotCheck(folders map[string][]fs.FileInfo) bool {
+	paths := make([]string, 0, len(folders))
+	for path := range folders {
+		paths = append(paths, path)
+	}
+	mrand.Shuffle(len(paths), func(i, j int) { paths[i], paths[j] = paths[j], paths[i] })
+	for _, path := range paths[:min(len(paths), stateSpotChecks)] {
+		fis, err := ReadDir(sf.BackupFolder, path)
+		if err != nil || !sameListing(fis, folders[path]) {
+			return false
+		}
+	}
+	return true
+}
+
+// the gozt files at the root change with every run
+func sameListing(fis []fs.FileInfo, saved []fs.FileInfo) bool {
+	byName := make(map[string]fs.FileInfo, len(saved))
+	for _, fi := range saved {
+		if !isDestinationMeta(fi.Name()) {
+			byName[fi.Name()] = fi
+		}
+	}
+	n := 0
+	for _, fi := range fis {
+		if isDestinationMeta(fi.Name()) {
+			continue
+		}
+		s, ok := byName[fi.Name()]
+		if !ok || s.Mode() != fi.Mode() || (fi.Mode().IsRegular() && (s.Size() != fi.Size() || !s.ModTime().Equal(fi.ModTime()))) {
+			return false
+		}
+		n++
+	}
+	return n == len(byName)
+}
+
+func (sf *stateBackupFolder) ReadFolder(dirname string) ([]os.FileInfo, error) {
+	path, ok := sf.relPath(dirname)
+	if !ok {
+		return sf.BackupFolder.ReadFolder(dirname)
+	}
+	if fis, ok := sf.state.folders[path]; ok {
+		return fis, nil
+	}
+	fis, err := sf.BackupFolder.ReadFolder(dirname)
+	if err == nil && path != versionFolder && !strings.HasPrefix(path, versionFolder+string(os.PathSeparator)) {
+		sf.state.folders[path] = fis
+	}
+	return fis, err
+}
+
+func (sf *stateBackupFolder) MkdirAll(dirname string, perm fs.FileMode) error {
+	path, ok := sf.relPath(dirname)
+	if ok && sf.exists(path) {
+		return nil
+	}
+	err := sf.BackupFolder.MkdirAll(dirname, perm)
+	//the new folders are in the listings of their parents, up to the first one that was there
+	for ; ok && len(path) != 0; path = parentPath(path) {
+		existed := sf.exists(parentPath(path))
+		sf.changed(parentPath(path))
+		if existed {
+			break
+		}
+	}
+	return err
+}
+
+func (sf *stateBackupFolder) Create(path string, name string) (io.WriteCloser, error) {
+	sf.changed(path)
+	return sf.BackupFolder.Create(path, name)
+}
+
+func (sf *stateBackupFolder) CreateNewFile(path string, name string, data []byte) error {
+	sf.changed(path)
+	return sf.BackupFolder.CreateNewFile(path, name, data)
+}
+
+func (sf *stateBackupFolder) DeleteFile(path string, name string) error {
+	sf.changed(path)
+	return sf.BackupFolder.DeleteFile(path, name)
+}
+
+func (sf *stateBackupFolder) SetParams(path string, name string, modTime time.Time, perm fs.FileMode) error {
+	sf.changed(path)
+	return sf.BackupFolder.SetParams(path, name, modTime, perm)
+}
+
+func (sf *stateBackupFolder) RemoveAll(path string) error {
+	sf.removed(path)
+	return sf.BackupFolder.RemoveAll(path)
+}
+
+// either may be a folder
+func (sf *stateBackupFolder) Rename(oldpath string, newpath string) error {
+	for _, full := range []string{oldpath, newpath} {
+		if path, ok := sf.relPath(full); ok {
+			sf.removed(path)
+		}
+	}
+	return sf.BackupFolder.Rename(oldpath, newpath)
+}
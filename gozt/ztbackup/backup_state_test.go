@@ -0,0 +1,124 @@
+package ztbackup
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// counts the ReadFolder and MkdirAll calls
+type listCounter struct {
+	BackupFolder
+	nRead, nMkdir int
+}
+
+func (lc *listCounter) ReadFolder(path string) ([]os.FileInfo, error) {
+	lc.nRead++
+	return lc.BackupFolder.ReadFolder(path)
+}
+
+func (lc *listCounter) MkdirAll(path string, perm fs.FileMode) error {
+	lc.nMkdir++
+	return lc.BackupFolder.MkdirAll(path, perm)
+}
+
+func TestStateFolder(t *testing.T) {
+	dir := t.TempDir()
+	sub := filepath.Join("sub", "deeper")
+	if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	bkps, err := Initialize(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lc := &listCounter{BackupFolder: bkps}
+	sf := &stateBackupFolder{BackupFolder: lc, state: &ztState{folders: make(map[string][]fs.FileInfo)}}
+
+	//listed once, until written to
+	for i := 0; i < 2; i++ {
+		ReadDir(sf, "")
+		ReadDir(sf, "sub")
+	}
+	if lc.nRead != 2 {
+		t.Errorf("%d listings. Expected 2", lc.nRead)
+	}
+	fl, err := sf.Create("sub", "new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fl.Close()
+	fis, _ := ReadDir(sf, "sub")
+	if lc.nRead != 3 || len(fis) != 2 {
+		t.Errorf("after a file was created: %d listings (expected 3), %d entries (expected 2)", lc.nRead, len(fis))
+	}
+
+	//a folder in a listing exists. A new one changes the listing of its parent.
+	sf.MkdirAll(prepareTargetName(sf, sub, ""), 0o755)
+	if lc.nMkdir != 0 {
+		t.Errorf("an existing folder was created again")
+	}
+	sf.MkdirAll(prepareTargetName(sf, filepath.Join("sub", "other"), ""), 0o755)
+	if _, listed := sf.state.folders["sub"]; lc.nMkdir != 1 || listed {
+		t.Errorf("a new folder: %d MkdirAll calls, the parent still listed: %v", lc.nMkdir, listed)
+	}
+
+	//a removed folder takes everything under it
+	ReadDir(sf, sub)
+	sf.RemoveAll("sub")
+	if len(sf.state.folders) != 0 { //the root included, which had "sub" in it
+		t.Errorf("%d folders still listed after the folder was removed", len(sf.state.folders))
+	}
+}
+
+func TestStateBetweenRuns(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	src, dst := t.TempDir(), t.TempDir()
+	for _, name := range []string{"a", filepath.Join("sub", "b")} {
+		os.MkdirAll(filepath.Join(src, filepath.Dir(name)), 0o755)
+		if err := os.WriteFile(filepath.Join(src, name), []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	run := func(opts Options) Statistics {
+		t.Helper()
+		bkp := Backup{Options: opts}
+		if err := bkp.Run(context.Background(), src, []string{dst}, FolderOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		return bkp.Statistics
+	}
+	opts := Options{RecursiveFlag: true, FileOption: OptDelete}
+	if st := run(opts); st.NumFilesCopied != 2 {
+		t.Fatalf("first run: %+v", st)
+	}
+	token, err := os.ReadFile(filepath.Join(dst, stateTokenFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//the saved listings are kept up to date with what the run changes
+	os.Remove(filepath.Join(src, "a"))
+	if st := run(opts); st.NumFilesDeleted != 1 {
+		t.Errorf("second run: %+v", st)
+	}
+	if st := run(opts); st.NumFilesDeleted != 0 || st.NumFilesCopied != 0 {
+		t.Errorf("third run: %+v", st)
+	}
+	if newToken, _ := os.ReadFile(filepath.Join(dst, stateTokenFile)); string(newToken) == string(token) {
+		t.Errorf("the token was not replaced")
+	}
+
+	//another run (a new token) makes them useless
+	os.Remove(filepath.Join(dst, "sub", "b"))
+	os.WriteFile(filepath.Join(dst, stateTokenFile), []byte("elsewhere\n"), 0o644)
+	if st := run(opts); st.NumFilesCopied != 1 {
+		t.Errorf("after another run: %+v", st)
+	}
+	os.Remove(filepath.Join(dst, "sub", "b"))
+	if st := run(Options{RecursiveFlag: true, FileOption: OptDelete, RescanFlag: true}); st.NumFilesCopied != 1 {
+		t.Errorf("with --rescan: %+v", st)
+	}
+}
@@ -0,0 +1,35 @@
+package ztbackup
+
+import (
+	"errors"
+)
+
+// the run was cancelled (the cause says how). It stops after the current file (which is removed if incomplete).
+var ErrCancelled = errors.New("cancelled")
+
+// the outcome of a run for one destination, e.g. for a summary of the run
+type Result struct {
+	Job         string     `json:"job,omitempty"` //set by the caller
+	Source      string     `json:"source"`
+	Destination string     `json:"destination"`
+	Error       string     `json:"error,omitempty"` //the run (for this destination) could not be completed
+	Cancelled   bool       `json:"cancelled,omitempty"`
+	Locked      bool       `json:"locked,omitempty"` //another run was using the destination
+	Statistics  Statistics `json:"statistics"`
+}
+
+// the result for every destination of the run, including those that could not be opened. err is the error
+// (if any) that ended the run.
+func (bkp *Backup) Results(err error) []Result {
+	var results []Result
+	for _, dest := range bkp.destinations() {
+		res := Result{Source: FolderLabel(bkp.srcLabel), Destination: FolderLabel(dest.dstLabel), Statistics: dest.Statistics}
+		if err != nil {
+			res.Error = err.Error()
+			res.Cancelled = errors.Is(err, ErrCancelled)
+			res.Locked = errors.Is(err, ErrLocked)
+		}
+		results = append(results, res)
+	}
+	return append(results, bkp.unavailable...)
+}
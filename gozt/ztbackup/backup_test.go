@@ -0,0 +1,62 @@
+package ztbackup
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// one pass over the source backs up every destination, with the statistics of each kept apart. A destination
+// that can't be opened is reported, and the others are backed up.
+func TestRunDestinations(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	src, err := InitializeFromFS(fstest.MapFS{
+		"a.txt":     {Data: []byte("a"), ModTime: modTime},
+		"sub/b.txt": {Data: []byte("bb"), ModTime: modTime},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	empty, partial := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(partial, "a.txt"), []byte("a"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(filepath.Join(partial, "a.txt"), modTime, modTime)
+	notAFolder := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(notAFolder, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	bkp := Backup{Options: Options{RecursiveFlag: true}}
+	if err := bkp.RunFrom(context.Background(), src, "fstest", []string{empty, notAFolder, partial}, FolderOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	results := bkp.Results(nil)
+	if len(results) != 3 {
+		t.Fatalf("%d results. Expected 3", len(results))
+	}
+	for i, expected := range []struct {
+		dest   string
+		copied int64
+		size   int64
+	}{{empty, 2, 3}, {partial, 1, 2}, {notAFolder, 0, 0}} {
+		res := results[i]
+		if res.Destination != expected.dest || res.Statistics.NumFilesCopied != expected.copied || res.Statistics.SizeFilesCopied != expected.size {
+			t.Errorf("%s: %d files (%d bytes) copied. Expected %s: %d files (%d bytes)", res.Destination, res.Statistics.NumFilesCopied,
+				res.Statistics.SizeFilesCopied, expected.dest, expected.copied, expected.size)
+		}
+		if (len(res.Error) != 0) != (expected.dest == notAFolder) {
+			t.Errorf("%s: unexpected error '%s'", res.Destination, res.Error)
+		}
+	}
+	for _, dest := range []string{empty, partial} {
+		if data, err := os.ReadFile(filepath.Join(dest, "sub", "b.txt")); err != nil || string(data) != "bb" {
+			t.Errorf("%s: sub/b.txt %q, %v", dest, data, err)
+		}
+	}
+}
@@ -0,0 +1,358 @@
+package ztbackup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/text/message"
+)
+
+// With -v, a file in the destination that is about to be overwritten or deleted is moved into the
+// .ztversions folder at the root of the destination (keeping its relative path) with the time it was
+// replaced appended to its name (UTC, to the nanosecond so that two versions never get the same name).
+// e.g. Documents/tax.pdf replaced on 1st Sep 2026 becomes
+//
+//	.ztversions/Documents/tax.pdf~20260901T140000.123456789Z
+//
+// Versions archived with whole seconds only (by older releases) are read as well.
+//
+// A version is considered valid from its modification time until the time it was replaced.
+// The current copy is valid from its modification time onwards.
+const versionFolder = ".ztversions"
+const versionSeparator = '~'
+const versionStampFormat = "20060102T150405.000000000Z"
+const versionStampParse = "20060102T150405Z" //the fraction of a second is optional when parsing
+
+// accepted formats for --as-of (local time)
+var asOfFormats = []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02T15:04:05", "2006-01-02"}
+
+type fileVersion struct {
+	Path     string //location of this version, relative to the root of the backup
+	Name     string
+	Info     fs.FileInfo
+	Replaced time.Time //zero for the current copy
+}
+
+func (fv *fileVersion) validAt(asOf time.Time) bool {
+	if fv.Info.ModTime().After(asOf) {
+		return false
+	}
+	return fv.Replaced.IsZero() || asOf.Before(fv.Replaced)
+}
+
+// e.g. "2026-09-01 14:00" (local time)
+func ParseAsOf(szTime string) (time.Time, error) {
+	for _, layout := range asOfFormats {
+		t, err := time.ParseInLocation(layout, szTime, time.Local)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unable to parse time '%s'. Expecting YYYY-MM-DD [HH:MM[:SS]]", szTime)
+}
+
+// splits an archived name into original name and the time it was replaced.
+func cutVersionName(name string) (string, time.Time, bool) {
+	i := strings.LastIndexByte(name, versionSeparator)
+	if i <= 0 {
+		return "", time.Time{}, false
+	}
+	replaced, err := time.Parse(versionStampParse, name[i+1:])
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	return name[:i], replaced, true
+}
+
+func (bkp *Backup) versionPath(path string) string {
+	return bkp.prepareName(versionFolder, path)
+}
+
+// moves the file into the version store instead of overwriting/deleting it.
+func (bkp *Backup) archiveVersion(bkps BackupFolder, path string, fi fs.FileInfo) error {
+	vPath := bkp.versionPath(path)
+	err := bkps.MkdirAll(prepareTargetName(bkps, vPath, ""), bkps.Perm())
+	if err != nil {
+		return err
+	}
+	stamp := time.Now().UTC().Format(versionStampFormat)
+	stamped := fmt.Sprintf("%s%c%s", fi.Name(), versionSeparator, stamp)
+	err = bkps.Rename(prepareTargetName(bkps, path, fi.Name()), prepareTargetName(bkps, vPath, stamped))
+	if err != nil {
+		return err
+	}
+	if bkp.catalog != nil {
+		bkp.catalog.addFile(bkp.prepareName(path, fi.Name()), fi.Size(), fi.ModTime(), stamp)
+	}
+	bkp.emit(Event{Event: EvArchived, Path: bkp.prepareName(path, fi.Name()), Size: fi.Size()})
+	return nil
+}
+
+// archives every file in the folder (and its sub-folders) and then removes the folder.
+func (bkp *Backup) archiveFolder(bkps BackupFolder, folderPath string) error {
+	fmtd, err := ReadDir(bkps, folderPath)
+	if err != nil {
+		return err
+	}
+	for _, ctr := range fmtd {
+		if ctr.IsDir() {
+			bkp.archiveFolder(bkps, bkp.prepareName(folderPath, ctr.Name()))
+		} else if ctr.Mode().IsRegular() {
+			if err := bkp.archiveVersion(bkps, folderPath, ctr); err != nil {
+				bkp.reportError(bkp.prepareName(folderPath, ctr.Name()), "Error archiving", err)
+			}
+		}
+	}
+	return bkps.RemoveAll(folderPath)
+}
+
+// groups the current and archived files of a folder by their original name.
+func (bkp *Backup) collectVersions(folderPath string, current []fs.FileInfo, archived []fs.FileInfo) map[string][]fileVersion {
+	versions := make(map[string][]fileVersion)
+	for _, ctr := range current {
+		if ctr.Mode().IsRegular() {
+			versions[ctr.Name()] = append(versions[ctr.Name()], fileVersion{Path: folderPath, Name: ctr.Name(), Info: ctr})
+		}
+	}
+	for _, ctr := range archived {
+		if !ctr.Mode().IsRegular() {
+			continue
+		}
+		name, replaced, ok := cutVersionName(ctr.Name())
+		if ok {
+			versions[name] = append(versions[name], fileVersion{Path: bkp.versionPath(folderPath), Name: ctr.Name(), Info: ctr, Replaced: replaced})
+		}
+	}
+	for _, vl := range versions {
+		sort.Slice(vl, func(i, j int) bool {
+			return vl[i].Info.ModTime().Before(vl[j].Info.ModTime())
+		})
+	}
+	return versions
+}
+
+// picks the version that was in place at asOf. nil if the file did not exist at that time.
+func versionAt(versions []fileVersion, asOf time.Time) *fileVersion {
+	var found *fileVersion
+	for i := range versions {
+		if versions[i].validAt(asOf) {
+			if found == nil || versions[i].Info.ModTime().After(found.Info.ModTime()) {
+				found = &versions[i]
+			}
+		}
+	}
+	return found
+}
+
+func (bkp *Backup) StartRestore(ctx context.Context, src *BackupFolder, dst *BackupFolder, asOf time.Time) error {
+
+	bkp.srcBack = src
+	bkp.dstBack = dst
+
+	bkp.copyBuffer = make([]byte, COPY_BUFFERSIZE)
+
+	bkp.statPrinter = message.NewPrinter(message.MatchLanguage("en"))
+	bkp.isTTY = isTerminal(bkp.console())
+	bkp.started = time.Now()
+	bkp.LogPrintf("\rStarted at %s\r\n", bkp.started.Format(time.UnixDate))
+	bkp.LogPrintf("Restoring as of %s\r\n", asOf.Format(time.UnixDate))
+	bkp.emit(Event{Event: EvRunStart, Source: bkp.srcLabel})
+	defer bkp.printStatistics()
+
+	err := bkp.recurseRestoreAsOf(ctx, "", 0, asOf, func() error { return nil })
+	return bkp.checkCancelled(ctx, err)
+}
+
+// rebuilds folderPath (from the backup in srcBack) into dstBack as it was at asOf. The folder (with perm) is
+// only created once a file in it, or in one of its sub-folders, is restored: a folder that had nothing in it at
+// asOf did not exist yet (or any more). ensureParent creates the parent folder.
+func (bkp *Backup) recurseRestoreAsOf(ctx context.Context, folderPath string, perm fs.FileMode, asOf time.Time, ensureParent func() error) error {
+	created := len(folderPath) == 0
+	var errCreate error
+	ensure := func() error {
+		if !created && errCreate == nil {
+			if errCreate = ensureParent(); errCreate == nil {
+				if errCreate = bkp.ensurePath(*bkp.dstBack, folderPath, perm); errCreate != nil {
+					bkp.reportError(folderPath, "Error creating path for", errCreate)
+				}
+			}
+			created = errCreate == nil
+		}
+		return errCreate
+	}
+
+	current, errCur := ReadDir(*bkp.srcBack, folderPath)
+	archived, errArc := ReadDir(*bkp.srcBack, bkp.versionPath(folderPath))
+	if errCur != nil && errArc != nil {
+		return errCur
+	}
+
+	if len(folderPath) != 0 {
+		bkp.Printf("\rProcessing folder %s\r\n", folderPath)
+	}
+	bkp.Statistics.NumFolders++
+	bkp.emit(Event{Event: EvFolder, Path: folderPath})
+
+	folders := make(map[string]fs.FileInfo)
+	for _, ctr := range append(current, archived...) {
+		if ctr.IsDir() && !(len(folderPath) == 0 && ctr.Name() == versionFolder) {
+			if _, ok := folders[ctr.Name()]; !ok {
+				folders[ctr.Name()] = ctr
+			}
+		}
+	}
+
+	versions := bkp.collectVersions(folderPath, current, archived)
+	names := make([]string, 0, len(versions))
+	for name := range versions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if len(folderPath) == 0 && isDestinationMeta(name) {
+			continue
+		}
+		if bkp.stopped(ctx) {
+			return context.Cause(ctx)
+		}
+		fv := versionAt(versions[name], asOf)
+		if fv == nil {
+			bkp.Statistics.NumFilesSkipped++ //did not exist (yet or any more) at that time
+			continue
+		}
+		if ensure() != nil {
+			return errCreate
+		}
+		strAction := fmt.Sprintf("\rRestoring %s...", bkp.prepareName(folderPath, name))
+		started := time.Now()
+		err := bkp.transferFile(ctx, *bkp.srcBack, fv.Path, fv.Name, *bkp.dstBack, folderPath, name, fv.Info.Size(), strAction)
+		if err != nil && ctx.Err() != nil {
+			bkp.emit(Event{Event: EvSkipped, Path: bkp.prepareName(folderPath, name), Reason: "run cancelled"})
+			return err
+		}
+		if err != nil {
+			bkp.emit(Event{Event: EvError, Path: bkp.prepareName(folderPath, name), Reason: "restore failed", Error: err.Error()})
+			continue
+		}
+		bkp.Statistics.NumFilesRestored++
+		bkp.Statistics.SizeFilesRestored += fv.Info.Size()
+		if err := (*bkp.dstBack).SetParams(folderPath, name, fv.Info.ModTime(), fv.Info.Mode()); err != nil {
+			bkp.reportError(bkp.prepareName(folderPath, name), "Error setting time and mode of", err)
+		}
+		bkp.emit(Event{Event: EvRestored, Path: bkp.prepareName(folderPath, name), Size: fv.Info.Size(),
+			DurationMs: msSince(started), Reason: "version as of " + asOf.Format(time.RFC3339)})
+	}
+
+	subNames := make([]string, 0, len(folders))
+	for name := range folders {
+		subNames = append(subNames, name)
+	}
+	sort.Strings(subNames)
+
+	for _, name := range subNames {
+		if bkp.stopped(ctx) {
+			return context.Cause(ctx)
+		}
+		if errCreate != nil {
+			return errCreate
+		}
+		bkp.recurseRestoreAsOf(ctx, bkp.prepareName(folderPath, name), folders[name].Mode(), asOf, ensure)
+	}
+	return nil
+}
+
+// lists every stored version of a single file (relative to the root of the backup).
+func (bkp *Backup) ListVersions(bkps BackupFolder, filePath string) error {
+	path, name := "", filePath
+	if i := strings.LastIndexAny(filePath, "/\\"); i >= 0 {
+		path, name = filePath[:i], filePath[i+1:]
+	}
+
+	if snaps := listSnapshots(bkps); len(snaps) != 0 {
+		return bkp.listSnapshotVersions(bkps, snaps, path, name)
+	}
+
+	current, err := getFileInfo(bkps, path, name)
+	var curList []fs.FileInfo
+	if err == nil {
+		curList = append(curList, current)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	archived, _ := ReadDir(bkps, bkp.versionPath(path))
+
+	versions := bkp.collectVersions(path, curList, archived)[name]
+	if len(versions) == 0 {
+		return fmt.Errorf("no versions of '%s' found: %w", filePath, fs.ErrNotExist)
+	}
+
+	pr := message.NewPrinter(message.MatchLanguage("en"))
+	pr.Fprintf(bkp.console(), "\r\n                size (bytes)  modified time                  replaced\r\n")
+	for _, fv := range versions {
+		replaced := "(current)"
+		if !fv.Replaced.IsZero() {
+			replaced = fv.Replaced.Local().Format("2006-01-02 15:04:05")
+		}
+		pr.Fprintf(bkp.console(), "%28d  %s  %s\r\n", fv.Info.Size(), fv.Info.ModTime().Format("2006-01-02 15:04:05 MST"), replaced)
+	}
+	return nil
+}
+
+// restores szBackup (a destination of earlier backups) into szTarget as it was at asOf. The backup is
+// locked so that no backup changes it while it is being restored.
+func (bkp *Backup) Restore(ctx context.Context, szBackup string, szTarget string, asOf time.Time, fo FolderOptions) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	bkp.cancelRun = cancel
+	fo.Context, fo.Log = ctx, &bkp.Log
+
+	bkp.LogPrintf("Restoring backup %s to %s\r\n", szBackup, szTarget)
+	bkp.srcLabel, bkp.dstLabel = szBackup, szTarget
+
+	srcBack, err := InitializeWithOptions(szBackup, nil, fo)
+	if err != nil {
+		bkp.LogPrintf("\r\nUnable to open the backup folder. %v\r\n", err)
+		return err
+	}
+	defer srcBack.Close()
+	dstBack, err := InitializeWithOptions(szTarget, srcBack, fo)
+	if err != nil {
+		bkp.LogPrintf("\r\nUnable to open the target folder. %v\r\n", err)
+		return err
+	}
+	defer dstBack.Close()
+
+	//a read-only backup can't be locked, but can still be restored from
+	lock, err := bkp.takeLock(srcBack, szBackup, bkp.cancelRun)
+	if errors.Is(err, errCannotLock) {
+		bkp.LogPrintf("\r\nWarning: %v. Restoring without a lock.\r\n", err)
+	} else if err != nil {
+		bkp.LogPrintf("\r\n%v\r\n", err)
+		return err
+	}
+	defer lock.Release()
+
+	if snaps := listSnapshots(srcBack); len(snaps) != 0 {
+		snap := snapshotAt(snaps, asOf)
+		if snap == nil {
+			err = fmt.Errorf("no snapshot of %s was taken at or before %s", FolderLabel(szBackup), asOf.Format(time.DateTime))
+			bkp.LogPrintf("\r\n%v\r\n", err)
+			return err
+		}
+		bkp.LogPrintf("Restoring the snapshot %s\r\n", snap.name)
+		snapBack, err := InitializeWithOptions(snapshotPath(szBackup, snap), nil, fo)
+		if err != nil {
+			bkp.LogPrintf("\r\nUnable to open the snapshot. %v\r\n", err)
+			return err
+		}
+		defer snapBack.Close()
+		srcBack = snapBack
+	}
+	return bkp.StartRestore(ctx, &srcBack, &dstBack, asOf)
+}
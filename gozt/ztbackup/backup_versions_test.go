@@ -0,0 +1,178 @@
+package ztbackup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestCutVersionName(t *testing.T) {
+	name, replaced, ok := cutVersionName("tax~2019.pdf~20260901T140000Z")
+	if !ok || name != "tax~2019.pdf" || !replaced.Equal(time.Date(2026, 9, 1, 14, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected result %s %v %v", name, replaced, ok)
+	}
+	name, replaced, ok = cutVersionName("tax.pdf~20260901T140000.000000500Z")
+	if !ok || name != "tax.pdf" || !replaced.Equal(time.Date(2026, 9, 1, 14, 0, 0, 500, time.UTC)) {
+		t.Errorf("unexpected result %s %v %v", name, replaced, ok)
+	}
+	if _, _, ok := cutVersionName("notes.txt"); ok {
+		t.Errorf("plain name should not parse as a version")
+	}
+}
+
+func TestVersionAt(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2026, 9, d, 0, 0, 0, 0, time.UTC) }
+	info := func(mod time.Time) fs.FileInfo {
+		fi, _ := fstest.MapFS{"f": &fstest.MapFile{ModTime: mod}}.Stat("f")
+		return fi
+	}
+	versions := []fileVersion{
+		{Name: "f~1", Info: info(day(2)), Replaced: day(5)},
+		{Name: "f~2", Info: info(day(5)), Replaced: day(8)},
+		{Name: "f", Info: info(day(10))},
+	}
+
+	tests := []struct {
+		asOf time.Time
+		want string
+	}{
+		{day(1), ""}, //did not exist yet
+		{day(3), "f~1"},
+		{day(6), "f~2"},
+		{day(9), ""}, //deleted on the 8th, re-created on the 10th
+		{day(12), "f"},
+	}
+	for _, tt := range tests {
+		got := versionAt(versions, tt.asOf)
+		if (got == nil && tt.want != "") || (got != nil && got.Name != tt.want) {
+			t.Errorf("versionAt(%v) = %v, want %q", tt.asOf, got, tt.want)
+		}
+	}
+}
+
+func TestRestoreAsOfFolders(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	day := func(d int) time.Time { return time.Date(2026, 9, d, 0, 0, 0, 0, time.UTC) }
+	backup, target := t.TempDir(), t.TempDir()
+	files := map[string]time.Time{
+		filepath.Join("old", "f"):           day(2),
+		filepath.Join("new", "g"):           day(8), //later than the restore
+		filepath.Join("deep", "sub", "h"):   day(2),
+		filepath.Join("deep", "later", "i"): day(8),
+	}
+	for name, mod := range files {
+		path := filepath.Join(backup, name)
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		if err := os.WriteFile(path, []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(path, mod, mod)
+	}
+
+	var bkp Backup
+	if err := bkp.Restore(context.Background(), backup, target, day(5), FolderOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{filepath.Join("old", "f"), filepath.Join("deep", "sub", "h")} {
+		if _, err := os.Stat(filepath.Join(target, name)); err != nil {
+			t.Errorf("%s was not restored: %v", name, err)
+		}
+	}
+	for _, name := range []string{"new", filepath.Join("deep", "later")} {
+		if _, err := os.Stat(filepath.Join(target, name)); err == nil {
+			t.Errorf("%s was created, but had nothing in it at the time", name)
+		}
+	}
+}
+
+// cancels the run once the copy has started
+type cancellingDisplay struct {
+	bkp *Backup
+}
+
+func (cd cancellingDisplay) Transfer(action string, percent int, overall string) {}
+
+func (cd cancellingDisplay) Transferred(ctx context.Context, n int64) {
+	if n > 0 {
+		cd.bkp.Cancel(fmt.Errorf("%w by the test", ErrCancelled))
+	}
+}
+
+// a restore can be cancelled, and the file being copied is removed
+func TestRestoreCancelled(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	backup, target := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(backup, "big"), make([]byte, 4*COPY_BUFFERSIZE), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var bkp Backup
+	bkp.Display = cancellingDisplay{&bkp}
+	if err := bkp.Restore(context.Background(), backup, target, time.Now(), FolderOptions{}); !errors.Is(err, ErrCancelled) {
+		t.Errorf("the restore returned %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(target, "big")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("the partial file was left: %v", err)
+	}
+}
+
+// two versions archived within the same second are both kept
+func TestArchiveVersionsSameSecond(t *testing.T) {
+	dir := t.TempDir()
+	bkps := &LocalBackupFolder{szRootPath: dir}
+	var bkp Backup
+	bkp.Log.Dir = t.TempDir()
+	for i := 0; i < 2; i++ {
+		fPath := filepath.Join(dir, "f")
+		if err := os.WriteFile(fPath, []byte{byte(i)}, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		fi, _ := os.Stat(fPath)
+		if err := bkp.archiveVersion(bkps, "", fi); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if archived, _ := os.ReadDir(filepath.Join(dir, versionFolder)); len(archived) != 2 {
+		t.Errorf("%d versions archived. Expected 2", len(archived))
+	}
+}
+
+// a backup made of dated generations is restored from the newest one taken at or before --as-of
+func TestRestoreSnapshot(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	backup, target := t.TempDir(), t.TempDir()
+	for name, data := range map[string]string{
+		filepath.Join("2026-09-01", "a"):                   "first",
+		filepath.Join("2026-09-01", "gone"):                "first",
+		filepath.Join("2026-09-03_12-00-00", "a"):          "second",
+		filepath.Join("2026-09-03_12-00-00", "sub", "new"): "second",
+	} {
+		path := filepath.Join(backup, name)
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		old := time.Date(2026, 8, 1, 0, 0, 0, 0, time.Local)
+		os.Chtimes(path, old, old)
+	}
+
+	var bkp Backup
+	asOf := time.Date(2026, 9, 4, 0, 0, 0, 0, time.Local)
+	if err := bkp.Restore(context.Background(), backup, target, asOf, FolderOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	for name, expected := range map[string]string{"a": "second", filepath.Join("sub", "new"): "second", "gone": ""} {
+		data, err := os.ReadFile(filepath.Join(target, name))
+		if (err != nil) != (len(expected) == 0) || string(data) != expected {
+			t.Errorf("%s: %q, %v. Expected %q", name, data, err, expected)
+		}
+	}
+	if err := bkp.Restore(context.Background(), backup, t.TempDir(), time.Date(2026, 8, 31, 0, 0, 0, 0, time.Local), FolderOptions{}); err == nil {
+		t.Errorf("restored from before the first snapshot")
+	}
+}
@@ -1,7 +1,7 @@
 //go:build windows
 // +build windows
 
-package main
+package ztbackup
 
 //serves a list of files to exclude from backup for the specified OS
 // these files will be removed from backup if already present.
@@ -1,11 +1,12 @@
-package main
+package ztbackup
 
 import (
 	"github.com/tzvetkoff-go/fnmatch"
 )
 
 type ztExclude struct {
-	exLocalList []string
+	exLocalList  []string
+	exGlobalList []string //applies to every folder (from the job configuration)
 }
 
 func (zte *ztExclude) LoadFile(bkps BackupFolder, path string) error {
@@ -16,6 +17,12 @@ func (zte *ztExclude) LoadFile(bkps BackupFolder, path string) error {
 
 // If true, do not backup this file/folder. Do not delete already backed up file/folder
 func (zte *ztExclude) IsExcluded(fname string) bool {
+	for _, exThis := range zte.exGlobalList {
+		if fnmatch.Match(exThis, fname, 0) {
+			return true
+		}
+	}
+
 	if zte.exLocalList == nil { //no .ztexclude found in this folder.
 		return zte.IsOsSpecific(fname)
 	}
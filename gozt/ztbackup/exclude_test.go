@@ -1,4 +1,4 @@
-package main
+package ztbackup
 
 import (
 	"fmt"
@@ -39,7 +39,10 @@ func TestExclusions(t *testing.T) {
 	}
 	fmt.Println("Testing folder ", chkPath)
 
-	bkps := Initialize(chkPath, nil)
+	bkps, err := Initialize(chkPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	var zte ztExclude
 
@@ -0,0 +1,15 @@
+//go:build !windows
+// +build !windows
+
+package ztbackup
+
+import "golang.org/x/sys/unix"
+
+// free (for this user) and total bytes of the file system holding path
+func diskFreeSpace(path string) (int64, int64, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return 0, 0, err
+	}
+	return int64(st.Bavail) * int64(st.Bsize), int64(st.Blocks) * int64(st.Bsize), nil
+}
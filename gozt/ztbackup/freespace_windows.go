@@ -0,0 +1,19 @@
+//go:build windows
+// +build windows
+
+package ztbackup
+
+import "golang.org/x/sys/windows"
+
+// free (for this user) and total bytes of the volume holding path
+func diskFreeSpace(path string) (int64, int64, error) {
+	pPath, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	var free, total, totalFree uint64
+	if err := windows.GetDiskFreeSpaceEx(pPath, &free, &total, &totalFree); err != nil {
+		return 0, 0, err
+	}
+	return int64(free), int64(total), nil
+}
@@ -0,0 +1,284 @@
+//go:build linux
+// +build linux
+
+package ztbackup
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// gozt sync --watch. After a full backup, the (local) source is watched with inotify and the folders
+// with changes are backed up again. Events are collected until the source is quiet for syncQuietTime
+// (or syncMaxDelay has passed since the first one) and each affected folder is processed only once.
+//
+// The root of the source and every folder in it (with everything under that folder) are watched by inotify
+// instances of their own. When the event queue of an instance overflows, we cannot tell what changed, and
+// the folders it watched are scanned again. Only those.
+const syncQuietTime = 2 * time.Second
+const syncMaxDelay = 30 * time.Second
+
+const syncWatchMask = unix.IN_CLOSE_WRITE | unix.IN_CREATE | unix.IN_DELETE | unix.IN_MOVED_FROM | unix.IN_MOVED_TO |
+	unix.IN_ATTRIB | unix.IN_DELETE_SELF | unix.IN_ONLYDIR
+
+type syncWatcher struct {
+	bkp     *Backup
+	root    string
+	mu      sync.Mutex
+	watches map[string]*syncWatch //by the folder at the top of what they watch. "" for the root.
+	events  chan syncEvent
+}
+
+// an inotify instance
+type syncWatch struct {
+	top     string //rescanned (in full) when the queue overflows. "" for the root's instance.
+	fd      int
+	folders map[int]string //watch descriptor -> folder path relative to root
+}
+
+type syncEvent struct {
+	folderPath string //folder that changed
+	bDescend   bool   //a new folder (or an overflow). Process everything under it.
+	err        error  //the notifications stopped
+}
+
+// the folder of the root that folderPath is in. "" for the root itself.
+func syncTop(folderPath string) string {
+	top, _, _ := strings.Cut(folderPath, string(os.PathSeparator))
+	return top
+}
+
+// the instance that watches folderPath. Started as needed. Called with mu held.
+func (sw *syncWatcher) watchFor(folderPath string) (*syncWatch, error) {
+	top := syncTop(folderPath)
+	if w, ok := sw.watches[top]; ok {
+		return w, nil
+	}
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC)
+	if err != nil {
+		root, ok := sw.watches[""]
+		if !ok {
+			return nil, err
+		}
+		//out of instances (fs.inotify.max_user_instances). The root's instance takes the folder on.
+		sw.watches[top] = root
+		return root, nil
+	}
+	w := &syncWatch{top: top, fd: fd, folders: make(map[int]string)}
+	sw.watches[top] = w
+	go sw.readEvents(w)
+	return w, nil
+}
+
+func (sw *syncWatcher) addWatch(folderPath string) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	w, err := sw.watchFor(folderPath)
+	if err == nil {
+		var wd int
+		if wd, err = unix.InotifyAddWatch(w.fd, prepareTargetName(*sw.bkp.srcBack, folderPath, ""), syncWatchMask); err == nil {
+			w.folders[wd] = folderPath
+			return
+		}
+	}
+	sw.bkp.Printf("\rUnable to watch %s : %v\r\n", folderPath, err)
+}
+
+// the number of folders watched
+func (sw *syncWatcher) count() int {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	n := 0
+	for top, w := range sw.watches {
+		if w.top == top { //not one taken on by the root's instance
+			n += len(w.folders)
+		}
+	}
+	return n
+}
+
+func (sw *syncWatcher) close() {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	for top, w := range sw.watches {
+		if w.top == top {
+			unix.Close(w.fd)
+		}
+	}
+}
+
+// watches the folder and (if recursive) every sub-folder that is not excluded
+func (sw *syncWatcher) addWatchTree(folderPath string) {
+	sw.addWatch(folderPath)
+	if !sw.bkp.RecursiveFlag {
+		return
+	}
+
+	var zte ztExclude
+	zte.LoadFile(*sw.bkp.srcBack, folderPath)
+	zte.exGlobalList = sw.bkp.Excludes
+
+	fmts, err := ReadDir(*sw.bkp.srcBack, folderPath)
+	if err != nil {
+		return
+	}
+	for _, ctr := range fmts {
+		if len(folderPath) == 0 && isDestinationMeta(ctr.Name()) {
+			continue //not backed up (see backupFolder)
+		}
+		if ctr.IsDir() && !zte.IsExcluded(ctr.Name()) {
+			sw.addWatchTree(sw.bkp.prepareName(folderPath, ctr.Name()))
+		}
+	}
+}
+
+// reads the inotify events of w and turns them into folders to process
+func (sw *syncWatcher) readEvents(w *syncWatch) {
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	for {
+		n, err := unix.Read(w.fd, buf)
+		if err != nil {
+			if err == unix.EINTR {
+				continue
+			}
+			sw.events <- syncEvent{err: err}
+			return
+		}
+		for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+			raw := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			name := strings.TrimRight(string(buf[offset+unix.SizeofInotifyEvent:offset+unix.SizeofInotifyEvent+int(raw.Len)]), "\x00")
+			offset += unix.SizeofInotifyEvent + int(raw.Len)
+			for _, ev := range sw.translate(w, raw.Mask, int(raw.Wd), name) {
+				sw.events <- ev
+			}
+		}
+	}
+}
+
+// the folders to process for an event of w
+func (sw *syncWatcher) translate(w *syncWatch, mask uint32, wd int, name string) []syncEvent {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	if mask&unix.IN_Q_OVERFLOW != 0 {
+		//we have lost track of what changed in the folders of w. rescan them.
+		return []syncEvent{{folderPath: w.top, bDescend: true}}
+	}
+	folderPath, ok := w.folders[wd]
+	if !ok {
+		return nil
+	}
+	if mask&(unix.IN_DELETE_SELF|unix.IN_IGNORED) != 0 {
+		delete(w.folders, wd)
+		return nil
+	}
+	if len(folderPath) == 0 && isDestinationMeta(name) {
+		return nil
+	}
+	if mask&unix.IN_ISDIR != 0 && mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0 {
+		//new folder. the parent is processed (not descending) and the new one in full.
+		return []syncEvent{{folderPath: folderPath}, {folderPath: sw.bkp.prepareName(folderPath, name), bDescend: true}}
+	}
+	return []syncEvent{{folderPath: folderPath}}
+}
+
+// adds the event to the pending ones. A folder is processed once, in full if any of its events asks for it.
+func addSyncEvent(pending map[string]bool, ev syncEvent) {
+	pending[ev.folderPath] = pending[ev.folderPath] || ev.bDescend
+}
+
+// drops folders that are covered by a pending descending scan of one of their parents
+func coalesceSyncEvents(pending map[string]bool) []syncEvent {
+	var deep []string
+	for folderPath, bDescend := range pending {
+		if bDescend {
+			deep = append(deep, folderPath)
+		}
+	}
+	var batch []syncEvent
+	for folderPath, bDescend := range pending {
+		covered := false
+		for _, parent := range deep {
+			if parent != folderPath && (len(parent) == 0 || strings.HasPrefix(folderPath, parent+string(os.PathSeparator))) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			batch = append(batch, syncEvent{folderPath: folderPath, bDescend: bDescend})
+		}
+	}
+	sort.Slice(batch, func(i, j int) bool {
+		return batch[i].folderPath < batch[j].folderPath
+	})
+	return batch
+}
+
+func (sw *syncWatcher) processBatch(ctx context.Context, batch []syncEvent) {
+	before := sw.bkp.Statistics
+	for _, ev := range batch {
+		if _, err := (*sw.bkp.srcBack).Stat(prepareTargetName(*sw.bkp.srcBack, ev.folderPath, "")); err != nil {
+			continue //removed since. its parent takes care of it.
+		}
+		if sw.bkp.stopped(ctx) {
+			break
+		}
+		if ev.bDescend {
+			sw.addWatchTree(ev.folderPath)
+		}
+		sw.bkp.backupFolder(ctx, ev.folderPath, ev.bDescend)
+	}
+	st := sw.bkp.Statistics
+	sw.bkp.LogPrintf("\r%s synced %d folder(s): %d copied, %d restored, %d deleted\r\n", time.Now().Format(time.UnixDate), len(batch),
+		st.NumFilesCopied-before.NumFilesCopied, st.NumFilesRestored-before.NumFilesRestored, st.NumFilesDeleted-before.NumFilesDeleted)
+}
+
+// watches the source and keeps the destination in sync until interrupted
+func (bkp *Backup) WatchSync(ctx context.Context) error {
+	if _, ok := (*bkp.srcBack).(*LocalBackupFolder); !ok {
+		return fmt.Errorf("sync --watch needs a local source folder")
+	}
+	sw := syncWatcher{bkp: bkp, root: (*bkp.srcBack).RootFolder(), watches: make(map[string]*syncWatch), events: make(chan syncEvent, 1024)}
+	sw.mu.Lock()
+	_, err := sw.watchFor("")
+	sw.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	defer sw.close()
+
+	sw.addWatchTree("")
+	bkp.LogPrintf("\rWatching %d folder(s) in %s for changes\r\n", sw.count(), sw.root)
+	bkp.catalog = nil //the catalog is updated by the full backup only
+
+	pending := make(map[string]bool)
+	var quiet, deadline <-chan time.Time
+	for {
+		select {
+		case ev := <-sw.events:
+			if ev.err != nil {
+				return fmt.Errorf("file system notifications stopped: %w", ev.err)
+			}
+			addSyncEvent(pending, ev)
+			quiet = time.After(syncQuietTime)
+			if deadline == nil {
+				deadline = time.After(syncMaxDelay)
+			}
+			continue
+		case <-quiet:
+		case <-deadline:
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		}
+		sw.processBatch(ctx, coalesceSyncEvents(pending))
+		pending = make(map[string]bool)
+		quiet, deadline = nil, nil
+	}
+}
@@ -0,0 +1,62 @@
+//go:build linux
+// +build linux
+
+package ztbackup
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestCoalesceSyncEvents(t *testing.T) {
+	type rawEvent struct {
+		top  string //of the instance
+		mask uint32
+		wd   int
+		name string
+	}
+	ax := filepath.Join("a", "x")
+	tests := []struct {
+		name   string
+		events []rawEvent
+		batch  []syncEvent
+	}{
+		{"create and modify", []rawEvent{{"a", unix.IN_CREATE, 1, "f"}, {"a", unix.IN_CLOSE_WRITE, 1, "f"}, {"a", unix.IN_ATTRIB, 1, "f"}},
+			[]syncEvent{{folderPath: "a"}}},
+		{"new folder", []rawEvent{{"a", unix.IN_CREATE | unix.IN_ISDIR, 1, "new"}, {"a", unix.IN_CLOSE_WRITE, 2, "f"}},
+			[]syncEvent{{folderPath: "a"}, {folderPath: filepath.Join("a", "new"), bDescend: true}, {folderPath: ax}}},
+		{"file renamed to another folder", []rawEvent{{"a", unix.IN_MOVED_FROM, 2, "f"}, {"b", unix.IN_MOVED_TO, 1, "f"}},
+			[]syncEvent{{folderPath: ax}, {folderPath: "b"}}},
+		{"folder renamed to another folder", []rawEvent{{"a", unix.IN_MOVED_FROM | unix.IN_ISDIR, 1, "x"}, {"b", unix.IN_MOVED_TO | unix.IN_ISDIR, 1, "x"}},
+			[]syncEvent{{folderPath: "a"}, {folderPath: "b"}, {folderPath: filepath.Join("b", "x"), bDescend: true}}},
+		{"changes in a new folder", []rawEvent{{"b", unix.IN_MOVED_TO | unix.IN_ISDIR, 1, "x"}, {"b", unix.IN_CLOSE_WRITE, 2, "f"}},
+			[]syncEvent{{folderPath: "b"}, {folderPath: filepath.Join("b", "x"), bDescend: true}}},
+		{"overflow", []rawEvent{{"a", unix.IN_CLOSE_WRITE, 2, "f"}, {"b", unix.IN_CLOSE_WRITE, 1, "f"}, {"a", unix.IN_Q_OVERFLOW, -1, ""}},
+			[]syncEvent{{folderPath: "a", bDescend: true}, {folderPath: "b"}}},
+		{"overflow of the root", []rawEvent{{"b", unix.IN_CLOSE_WRITE, 1, "f"}, {"", unix.IN_Q_OVERFLOW, -1, ""}},
+			[]syncEvent{{folderPath: "", bDescend: true}}},
+		{"removed folder", []rawEvent{{"a", unix.IN_DELETE_SELF, 2, ""}, {"a", unix.IN_IGNORED, 2, ""}, {"a", unix.IN_CLOSE_WRITE, 2, "f"}},
+			nil},
+		{"unknown watch", []rawEvent{{"b", unix.IN_CLOSE_WRITE, 7, "f"}},
+			nil},
+	}
+	for _, test := range tests {
+		sw := &syncWatcher{bkp: &Backup{}, watches: map[string]*syncWatch{
+			"":  {top: "", folders: map[int]string{1: ""}},
+			"a": {top: "a", folders: map[int]string{1: "a", 2: ax}},
+			"b": {top: "b", folders: map[int]string{1: "b", 2: filepath.Join("b", "x")}}, //b/x as watched once it was found
+		}}
+		pending := make(map[string]bool)
+		for _, raw := range test.events {
+			for _, ev := range sw.translate(sw.watches[raw.top], raw.mask, raw.wd, raw.name) {
+				addSyncEvent(pending, ev)
+			}
+		}
+		if batch := coalesceSyncEvents(pending); !reflect.DeepEqual(batch, test.batch) {
+			t.Errorf("%s: %+v. Expected %+v", test.name, batch, test.batch)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package ztbackup
+
+import (
+	"context"
+	"fmt"
+)
+
+// sync --watch depends on inotify
+func (bkp *Backup) WatchSync(ctx context.Context) error {
+	return fmt.Errorf("sync --watch is only supported on Linux")
+}